@@ -0,0 +1,91 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cftest
+
+// Link returns user provided service pointing at the first route of given app
+func Link(guid, name string, app App) UserProvidedService {
+	return UserProvidedService{
+		GUID:        guid,
+		Name:        name,
+		Credentials: map[string]interface{}{"url": app.Routes[0].URL()},
+	}
+}
+
+// DiamondStack returns stack in which root app reaches the same app and the same service
+// through two different user provided services:
+//
+//	root -> left-ups -> left -> db
+//	root -> right-ups -> right -> db
+//	left -> shared-ups -> shared
+//	right -> shared-ups -> shared
+func DiamondStack() Stack {
+	shared := App{GUID: "shared-guid", Name: "shared", Routes: []Route{{Host: "shared"}}}
+	left := App{GUID: "left-guid", Name: "left", Routes: []Route{{Host: "left"}},
+		Bindings: []string{"db-guid", "shared-ups-guid"}}
+	right := App{GUID: "right-guid", Name: "right", Routes: []Route{{Host: "right"}},
+		Bindings: []string{"db-guid", "shared-ups-guid"}}
+	root := App{GUID: "root-guid", Name: "root", Routes: []Route{{Host: "root"}},
+		Bindings: []string{"left-ups-guid", "right-ups-guid"}}
+	return Stack{
+		Apps:     []App{root, left, right, shared},
+		Services: []Service{{GUID: "db-guid", Name: "db", Label: "postgresql93", Plan: "free"}},
+		UserProvidedServices: []UserProvidedService{
+			Link("left-ups-guid", "left-ups", left),
+			Link("right-ups-guid", "right-ups", right),
+			Link("shared-ups-guid", "shared-ups", shared),
+		},
+	}
+}
+
+// DanglingStack returns stack with user provided services whose credentials do not lead
+// to any application: an unknown host, a route without apps, a non-string url and no url at all.
+func DanglingStack() Stack {
+	root := App{GUID: "root-guid", Name: "root", Routes: []Route{{Host: "root"}},
+		Bindings: []string{"unknown-ups-guid", "unmapped-ups-guid", "no-url-ups-guid", "number-ups-guid"}}
+	unmapped := Route{Host: "unmapped"}
+	return Stack{
+		Apps:           []App{root},
+		UnmappedRoutes: []Route{unmapped},
+		UserProvidedServices: []UserProvidedService{
+			{GUID: "unknown-ups-guid", Name: "unknown-ups",
+				Credentials: map[string]interface{}{"url": "http://unknown." + DefaultDomain}},
+			{GUID: "unmapped-ups-guid", Name: "unmapped-ups",
+				Credentials: map[string]interface{}{"url": unmapped.URL()}},
+			{GUID: "no-url-ups-guid", Name: "no-url-ups",
+				Credentials: map[string]interface{}{"username": "admin"}},
+			{GUID: "number-ups-guid", Name: "number-ups",
+				Credentials: map[string]interface{}{"url": 8080}},
+		},
+	}
+}
+
+// CycleStack returns stack in which two apps are linked to each other with user provided services:
+//
+//	root -> backend-ups -> backend -> root-ups -> root
+func CycleStack() Stack {
+	root := App{GUID: "root-guid", Name: "root", Routes: []Route{{Host: "root"}},
+		Bindings: []string{"backend-ups-guid"}}
+	backend := App{GUID: "backend-guid", Name: "backend", Routes: []Route{{Host: "backend"}},
+		Bindings: []string{"root-ups-guid"}}
+	return Stack{
+		Apps: []App{root, backend},
+		UserProvidedServices: []UserProvidedService{
+			Link("backend-ups-guid", "backend-ups", backend),
+			Link("root-ups-guid", "root-ups", root),
+		},
+	}
+}
@@ -0,0 +1,359 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cftest provides in-process fake Cloud Controller and UAA servers
+// serving a declarative application stack, for offline tests of dependency discovery.
+package cftest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/trustedanalytics/go-cf-lib/api"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cloud Controller and UAA endpoints served by the fake, used as keys for call counters
+const (
+	EndpointAppSummary          = "app summary"
+	EndpointUserProvidedService = "user provided service"
+	EndpointSpaceRoutes         = "space routes"
+	EndpointRouteApps           = "route apps"
+	EndpointSpace               = "space"
+	EndpointInfo                = "info"
+	EndpointToken               = "token"
+	EndpointTokenKeys           = "token keys"
+)
+
+const (
+	// ClientID and ClientSecret are the only client credentials accepted by fake UAA
+	ClientID     = "cftest-client"
+	ClientSecret = "cftest-secret"
+	// AccessToken is issued by fake UAA and required by fake Cloud Controller
+	AccessToken = "cftest-token"
+	// TokenKeyID names the key signing tokens returned by Token
+	TokenKeyID = "cftest-key"
+)
+
+// Server is a fake Cloud Controller with its fake UAA.
+// Both are started on loopback interface with NewServer and must be closed with Close.
+type Server struct {
+	CC  *httptest.Server
+	UAA *httptest.Server
+
+	stack    Stack
+	key      *rsa.PrivateKey
+	mu       sync.Mutex
+	calls    map[string]int
+	failures map[string]bool
+	// Spaces readable with user tokens, by token
+	grants map[string]map[string]bool
+	// Tokens rejected when asking for spaces
+	revoked map[string]bool
+}
+
+// NewServer starts fake Cloud Controller and UAA serving given stack
+func NewServer(stack Stack) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{stack: stack, key: key, calls: make(map[string]int), failures: make(map[string]bool),
+		grants: make(map[string]map[string]bool), revoked: make(map[string]bool)}
+	s.CC = httptest.NewServer(http.HandlerFunc(s.serveCloudController))
+	s.UAA = httptest.NewServer(http.HandlerFunc(s.serveUAA))
+	return s
+}
+
+// Close shuts down both servers
+func (s *Server) Close() {
+	s.CC.Close()
+	s.UAA.Close()
+}
+
+// TokenURL returns the address of fake UAA token endpoint
+func (s *Server) TokenURL() string {
+	return s.UAA.URL + "/oauth/token"
+}
+
+// Setenv exports CF_API, TOKEN_URL, CLIENT_ID and CLIENT_SECRET pointing at the fake,
+// so that go-cf-lib api.NewCfAPI (and thus the whole server) talks to it.
+func (s *Server) Setenv() {
+	os.Setenv("CF_API", s.CC.URL)
+	os.Setenv("TOKEN_URL", s.TokenURL())
+	os.Setenv("CLIENT_ID", ClientID)
+	os.Setenv("CLIENT_SECRET", ClientSecret)
+}
+
+// NewCfAPI returns go-cf-lib client authenticated against the fake
+func (s *Server) NewCfAPI() *api.CfAPI {
+	s.Setenv()
+	return api.NewCfAPI()
+}
+
+// Calls returns how many times given endpoint was requested
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[endpoint]
+}
+
+// TotalCalls returns how many Cloud Controller requests were served, not counting UAA requests
+func (s *Server) TotalCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for endpoint, count := range s.calls {
+		if endpoint != EndpointToken && endpoint != EndpointTokenKeys {
+			total += count
+		}
+	}
+	return total
+}
+
+// ResetCalls zeroes all call counters
+func (s *Server) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = make(map[string]int)
+}
+
+// Fail makes Cloud Controller respond with internal server error to requests for given path,
+// e.g. "/v2/apps/app-guid/summary"
+func (s *Server) Fail(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = true
+}
+
+// Grant lets user presenting given token read given spaces. Other tokens than AccessToken
+// are accepted by fake Cloud Controller only when asking for spaces, and can read granted spaces only.
+func (s *Server) Grant(token string, spaceGUIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.grants[token] == nil {
+		s.grants[token] = make(map[string]bool)
+	}
+	for _, guid := range spaceGUIDs {
+		s.grants[token][guid] = true
+	}
+}
+
+// Revoke makes fake Cloud Controller reject given token with 401 Unauthorized when asking for spaces,
+// like expired token or one without cloud_controller.read scope
+func (s *Server) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[token] = true
+}
+
+func (s *Server) isRevoked(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revoked[token]
+}
+
+func (s *Server) isGranted(token, spaceGUID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return token == AccessToken || s.grants[token][spaceGUID]
+}
+
+func (s *Server) isFailing(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures[path]
+}
+
+func (s *Server) countCall(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[endpoint]++
+}
+
+// Token returns JWT signed with the key published by fake UAA at /token_keys.
+// Given claims are added to defaults, which make a token valid for an hour with no audience nor scopes.
+func (s *Server) Token(claims map[string]interface{}) string {
+	all := map[string]interface{}{
+		"iss": s.TokenURL(),
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		all[name] = value
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": TokenKeyID, "typ": "JWT"})
+	payload, _ := json.Marshal(all)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (s *Server) serveUAA(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" && r.URL.Path == "/token_keys" {
+		s.countCall(EndpointTokenKeys)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": TokenKeyID,
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+		return
+	}
+	if r.Method != "POST" || r.URL.Path != "/oauth/token" {
+		http.NotFound(w, r)
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		r.ParseForm()
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	s.countCall(EndpointToken)
+	if id != ClientID || secret != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": AccessToken,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (s *Server) serveCloudController(w http.ResponseWriter, r *http.Request) {
+	// Info is the only endpoint not requiring authentication
+	if r.Method == "GET" && r.URL.Path == "/v2/info" {
+		s.countCall(EndpointInfo)
+		if s.isFailing(r.URL.Path) {
+			writeJSON(w, http.StatusInternalServerError, ccError(10001, "An unknown error occurred"))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"name":                   "cftest",
+			"api_version":            "2.54.0",
+			"authorization_endpoint": s.UAA.URL,
+			"token_endpoint":         s.UAA.URL,
+		})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.Method == "GET" && len(parts) == 3 && parts[1] == "spaces" {
+		s.serveSpace(w, r, parts[2])
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+		writeJSON(w, http.StatusUnauthorized, ccError(1000, "Invalid Auth Token"))
+		return
+	}
+	if r.Method != "GET" {
+		writeJSON(w, http.StatusMethodNotAllowed, ccError(10000, "Unknown request"))
+		return
+	}
+
+	if s.isFailing(r.URL.Path) {
+		writeJSON(w, http.StatusInternalServerError, ccError(10001, "An unknown error occurred"))
+		return
+	}
+
+	switch {
+	case len(parts) == 4 && parts[1] == "apps" && parts[3] == "summary":
+		s.countCall(EndpointAppSummary)
+		if summary, ok := s.stack.appSummary(parts[2]); ok {
+			writeJSON(w, http.StatusOK, summary)
+			return
+		}
+		writeJSON(w, http.StatusNotFound, ccError(100004, "The app could not be found: "+parts[2]))
+	case len(parts) == 3 && parts[1] == "user_provided_service_instances":
+		s.countCall(EndpointUserProvidedService)
+		if ups, ok := s.stack.userProvidedService(parts[2]); ok {
+			writeJSON(w, http.StatusOK, types.CfUserProvidedServiceResource{
+				Meta: types.CfMeta{GUID: ups.GUID, URL: r.URL.Path},
+				Entity: types.CfUserProvidedService{
+					Name:        ups.Name,
+					SpaceGUID:   ups.spaceGUID(),
+					Credentials: ups.Credentials,
+				},
+			})
+			return
+		}
+		writeJSON(w, http.StatusNotFound, ccError(60004, "The service instance could not be found: "+parts[2]))
+	case len(parts) == 4 && parts[1] == "spaces" && parts[3] == "routes":
+		s.countCall(EndpointSpaceRoutes)
+		hostname := strings.TrimPrefix(r.URL.Query().Get("q"), "host:")
+		writeJSON(w, http.StatusOK, s.stack.spaceRoutesForHostname(parts[2], hostname))
+	case len(parts) == 4 && parts[1] == "routes" && parts[3] == "apps":
+		s.countCall(EndpointRouteApps)
+		writeJSON(w, http.StatusOK, s.stack.appsFromRoute(parts[2]))
+	default:
+		writeJSON(w, http.StatusNotFound, ccError(10000, "Unknown request"))
+	}
+}
+
+// serveSpace responds with space to callers allowed to read it
+func (s *Server) serveSpace(w http.ResponseWriter, r *http.Request, spaceGUID string) {
+	s.countCall(EndpointSpace)
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") || s.isRevoked(strings.TrimPrefix(header, "Bearer ")) {
+		writeJSON(w, http.StatusUnauthorized, ccError(1000, "Invalid Auth Token"))
+		return
+	}
+	if s.isFailing(r.URL.Path) {
+		writeJSON(w, http.StatusInternalServerError, ccError(10001, "An unknown error occurred"))
+		return
+	}
+	if !s.isGranted(strings.TrimPrefix(header, "Bearer "), spaceGUID) {
+		writeJSON(w, http.StatusForbidden, ccError(10003, "You are not authorized to perform the requested action"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"metadata": map[string]string{"guid": spaceGUID, "url": r.URL.Path},
+		"entity":   map[string]string{"name": spaceGUID, "organization_guid": s.stack.orgGUID(spaceGUID)},
+	})
+}
+
+func ccError(code int, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"code":        code,
+		"description": description,
+		"error_code":  fmt.Sprintf("CF-%v", code),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,244 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cftest
+
+import (
+	"fmt"
+	"github.com/trustedanalytics/go-cf-lib/types"
+)
+
+const (
+	// DefaultSpaceGUID is used for apps and user provided services which do not specify a space
+	DefaultSpaceGUID = "space-guid"
+	// DefaultDomain is used for routes which do not specify a domain
+	DefaultDomain = "apps.example.com"
+	// DefaultOrgGUID is the organization of spaces which are not given one in Stack.Orgs
+	DefaultOrgGUID = "org-guid"
+)
+
+// Stack is a declarative description of the Cloud Foundry content served by fake Cloud Controller
+type Stack struct {
+	Apps                 []App
+	Services             []Service
+	UserProvidedServices []UserProvidedService
+	// Routes in DefaultSpaceGUID mapped to no application
+	UnmappedRoutes []Route
+	// Organizations of spaces, by space GUID
+	Orgs map[string]string
+}
+
+// App describes an application together with its routes and bound service instances
+type App struct {
+	GUID      string
+	Name      string
+	SpaceGUID string
+	Routes    []Route
+	// GUIDs of bound services and user provided services
+	Bindings []string
+	Env      map[string]interface{}
+}
+
+// Route describes a route mapped to an application
+type Route struct {
+	GUID   string
+	Host   string
+	Domain string
+}
+
+// Service describes a managed service instance
+type Service struct {
+	GUID  string
+	Name  string
+	Label string
+	Plan  string
+}
+
+// UserProvidedService describes a user provided service instance
+type UserProvidedService struct {
+	GUID        string
+	Name        string
+	SpaceGUID   string
+	Credentials map[string]interface{}
+}
+
+// URL returns the address of the route, as it would be put into user provided service credentials
+func (r Route) URL() string {
+	return fmt.Sprintf("http://%v.%v", r.Host, r.domain())
+}
+
+func (r Route) domain() string {
+	if len(r.Domain) == 0 {
+		return DefaultDomain
+	}
+	return r.Domain
+}
+
+func (r Route) guid() string {
+	if len(r.GUID) == 0 {
+		return fmt.Sprintf("route-%v.%v", r.Host, r.domain())
+	}
+	return r.GUID
+}
+
+func (a App) spaceGUID() string {
+	if len(a.SpaceGUID) == 0 {
+		return DefaultSpaceGUID
+	}
+	return a.SpaceGUID
+}
+
+func (u UserProvidedService) spaceGUID() string {
+	if len(u.SpaceGUID) == 0 {
+		return DefaultSpaceGUID
+	}
+	return u.SpaceGUID
+}
+
+func (s *Stack) orgGUID(spaceGUID string) string {
+	if org, ok := s.Orgs[spaceGUID]; ok {
+		return org
+	}
+	return DefaultOrgGUID
+}
+
+func (s *Stack) app(guid string) (App, bool) {
+	for _, app := range s.Apps {
+		if app.GUID == guid {
+			return app, true
+		}
+	}
+	return App{}, false
+}
+
+func (s *Stack) service(guid string) (Service, bool) {
+	for _, svc := range s.Services {
+		if svc.GUID == guid {
+			return svc, true
+		}
+	}
+	return Service{}, false
+}
+
+func (s *Stack) userProvidedService(guid string) (UserProvidedService, bool) {
+	for _, ups := range s.UserProvidedServices {
+		if ups.GUID == guid {
+			return ups, true
+		}
+	}
+	return UserProvidedService{}, false
+}
+
+func (s *Stack) appSummary(guid string) (*types.CfAppSummary, bool) {
+	app, ok := s.app(guid)
+	if !ok {
+		return nil, false
+	}
+	summary := &types.CfAppSummary{
+		CfApp: types.CfApp{
+			Name:          app.Name,
+			SpaceGUID:     app.spaceGUID(),
+			State:         types.AppStarted,
+			InstanceCount: 1,
+			Memory:        256,
+			DiskQuota:     1024,
+			Envs:          app.Env,
+		},
+		GUID:     app.GUID,
+		Routes:   []types.CfAppSummaryRoute{},
+		Services: []types.CfAppSummaryService{},
+	}
+	for _, route := range app.Routes {
+		summary.Routes = append(summary.Routes, types.CfAppSummaryRoute{
+			GUID:   route.guid(),
+			Host:   route.Host,
+			Domain: types.CfDomain{GUID: "domain-" + route.domain(), Name: route.domain()},
+		})
+	}
+	for _, bound := range app.Bindings {
+		if svc, ok := s.service(bound); ok {
+			summary.Services = append(summary.Services, types.CfAppSummaryService{
+				GUID: svc.GUID,
+				Name: svc.Name,
+				Plan: types.CfAppSummaryServicePlan{
+					GUID:    "plan-" + svc.GUID,
+					Name:    svc.Plan,
+					Service: types.CfAppSummaryServicePlanService{GUID: "service-" + svc.Label, Label: svc.Label},
+				},
+			})
+		} else if ups, ok := s.userProvidedService(bound); ok {
+			summary.Services = append(summary.Services, types.CfAppSummaryService{
+				GUID: ups.GUID,
+				Name: ups.Name,
+			})
+		}
+	}
+	return summary, true
+}
+
+func (s *Stack) spaceRoutesForHostname(spaceGUID, hostname string) *types.CfRoutesResponse {
+	toReturn := &types.CfRoutesResponse{Pages: 1, Resources: []types.CfRouteResource{}}
+	routes := []Route{}
+	for _, app := range s.Apps {
+		if app.spaceGUID() == spaceGUID {
+			routes = append(routes, app.Routes...)
+		}
+	}
+	if spaceGUID == DefaultSpaceGUID {
+		routes = append(routes, s.UnmappedRoutes...)
+	}
+	for _, route := range routes {
+		if route.Host != hostname || containsRoute(toReturn.Resources, route.guid()) {
+			continue
+		}
+		toReturn.Resources = append(toReturn.Resources, types.CfRouteResource{
+			Meta:   types.CfMeta{GUID: route.guid(), URL: "/v2/routes/" + route.guid()},
+			Entity: types.CfRoute{Host: route.Host, DomainGUID: "domain-" + route.domain()},
+		})
+	}
+	toReturn.Count = len(toReturn.Resources)
+	return toReturn
+}
+
+func (s *Stack) appsFromRoute(routeGUID string) *types.CfAppsResponse {
+	toReturn := &types.CfAppsResponse{Pages: 1, Resources: []types.CfAppResource{}}
+	for _, app := range s.Apps {
+		for _, route := range app.Routes {
+			if route.guid() != routeGUID {
+				continue
+			}
+			toReturn.Resources = append(toReturn.Resources, types.CfAppResource{
+				Meta: types.CfMeta{GUID: app.GUID, URL: "/v2/apps/" + app.GUID},
+				Entity: types.CfApp{
+					Name:      app.Name,
+					SpaceGUID: app.spaceGUID(),
+					State:     types.AppStarted,
+				},
+			})
+		}
+	}
+	toReturn.Count = len(toReturn.Resources)
+	return toReturn
+}
+
+func containsRoute(routes []types.CfRouteResource, guid string) bool {
+	for _, route := range routes {
+		if route.Meta.GUID == guid {
+			return true
+		}
+	}
+	return false
+}
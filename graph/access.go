@@ -0,0 +1,44 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"fmt"
+)
+
+// AccessError is returned by discovery when the caller may not read the space of the root application
+type AccessError struct {
+	AppGUID   string
+	SpaceGUID string
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("Not allowed to discover application %v in space %v", e.AppGUID, e.SpaceGUID)
+}
+
+// TokenRejectedError is returned by discovery when Cloud Controller rejects token of the caller
+// while checking access to a space, e.g. because it expired or lacks cloud_controller.read scope.
+// It fails discovery even in tolerant mode.
+type TokenRejectedError struct {
+	SpaceGUID string
+	Status    string
+}
+
+func (e *TokenRejectedError) Error() string {
+	return fmt.Sprintf("Cloud Controller rejected token of the caller when checking access to space %v: %v",
+		e.SpaceGUID, e.Status)
+}
@@ -0,0 +1,47 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"sync"
+	"testing"
+)
+
+func TestTokenRejectedWhileCheckingLinkedSpace(t *testing.T) {
+	fake := cftest.NewServer(cftest.DiamondStack())
+	defer fake.Close()
+
+	for _, mode := range []ErrorMode{ErrorsStrict, ErrorsTolerant} {
+		// Space of the root application is readable, the token expires right after
+		var mutex sync.Mutex
+		checks := 0
+		canReadSpace := func(spaceGUID string) (bool, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			checks++
+			if checks > 1 {
+				return false, &TokenRejectedError{SpaceGUID: spaceGUID, Status: "401 Unauthorized"}
+			}
+			return true, nil
+		}
+		_, err := NewGraphAPI(CfClient{CfAPI: fake.NewCfAPI()}).Discover("root-guid", Options{Errors: mode, CanReadSpace: canReadSpace})
+		if _, ok := err.(*TokenRejectedError); !ok {
+			t.Errorf("%v: expected TokenRejectedError, got %v", mode, err)
+		}
+	}
+}
@@ -17,37 +17,117 @@
 package graph
 
 import (
-	"errors"
 	"fmt"
 	log "github.com/cihub/seelog"
-	"github.com/trustedanalytics/go-cf-lib/api"
 	"github.com/trustedanalytics/go-cf-lib/types"
 	"github.com/twmb/algoimpl/go/graph"
 )
 
+// CycleMode tells discovery what to do when application stack has cycles
+// swagger:enum CycleMode
+type CycleMode string
+
+const (
+	// CyclesFail rejects stacks with cycles with CycleError
+	CyclesFail CycleMode = "fail"
+	// CyclesDefer breaks cycles by deferring bindings of some user provided services
+	CyclesDefer CycleMode = "defer"
+)
+
+// ErrorMode tells discovery what to do when dependencies of some component cannot be retrieved
+// swagger:enum ErrorMode
+type ErrorMode string
+
+const (
+	// ErrorsStrict fails the whole discovery
+	ErrorsStrict ErrorMode = "strict"
+	// ErrorsTolerant returns partial result with warnings naming components which were not fully discovered
+	ErrorsTolerant ErrorMode = "tolerant"
+)
+
+// Options customize a single discovery
+type Options struct {
+	Cycles CycleMode
+	Errors ErrorMode
+	// Waves requests grouping components into waves which can be spawned concurrently
+	Waves bool
+	// Details requests details needed to clone every component
+	Details bool
+	// EnvLinks requests linking applications to those which urls in their environment point to
+	EnvLinks bool
+	// OnEvent, if set, is notified about components and dependencies as soon as they are found.
+	// It is called concurrently, from goroutines retrieving the stack.
+	OnEvent func(Event)
+	// CanReadSpace, if set, tells whether the caller may read given space. Discovery of application
+	// in a space the caller cannot read fails with AccessError, and applications linked from such spaces are left out.
+	// It is called concurrently, from goroutines retrieving the stack.
+	CanReadSpace func(spaceGUID string) (bool, error)
+}
+
+// Warning tells that dependencies of a component, or organization of its space in details,
+// could not be retrieved and are missing in the result
+type Warning struct {
+	GUID  string              `json:"GUID"`
+	Name  string              `json:"name"`
+	Type  types.ComponentType `json:"type"`
+	Error string              `json:"error"`
+}
+
+// Discovery is a plan of spawning application stack.
+// All Components are created first, in given order, then DeferredBindings are made.
+type Discovery struct {
+	Components       []types.Component
+	DeferredBindings []DeferredBinding
+	// GUIDs of components grouped into waves, when requested.
+	// Components of each wave depend only on components of previous waves, so they can be created concurrently.
+	Waves [][]string
+	// Components with details needed to clone them, in the same order, when requested
+	Details []DetailedComponent
+	// Components whose dependencies could not be retrieved, in tolerant mode
+	Warnings []Warning
+	// Number of dependencies between components, including deferred bindings
+	Edges int
+	// Dependencies between components with their kinds and evidence, including deferred bindings
+	DependencyEdges []DependencyEdge
+	// Cycles broken by deferring bindings
+	Cycles []Cycle
+	// Cloud Controller lookups made during discovery
+	Stats LookupStats
+}
+
 type GraphAPI struct {
-	w *api.CfAPI
+	cf CloudController
+	// Parallelism limits concurrent Cloud Controller lookups in a single discovery
+	Parallelism int
+	// Credentials tells which credentials of user provided services are scanned for urls of applications
+	Credentials CredentialScanner
 }
 
-func NewGraphAPI() *GraphAPI {
+func NewGraphAPI(cf CloudController) *GraphAPI {
 	toReturn := new(GraphAPI)
-	toReturn.w = api.NewCfAPI()
+	toReturn.cf = cf
+	toReturn.Parallelism = DefaultParallelism
 	return toReturn
 }
 
 // Returns a list of services and apps in application stack in reversed topological order
-func (gr *GraphAPI) Discover(sourceAppGUID string) ([]types.Component, error) {
-	sourceAppSummary, err := gr.w.GetAppSummary(sourceAppGUID)
+func (gr *GraphAPI) Discover(sourceAppGUID string, opts Options) (*Discovery, error) {
+	dg, g, cache, err := gr.buildGraph(sourceAppGUID, opts)
 	if err != nil {
 		return nil, err
 	}
-
-	g := graph.New(graph.Directed)
-	dg := NewDependencyGraph()
-	root := dg.NewNode(g, sourceAppGUID, sourceAppSummary.Name, types.ComponentApp, nil, true)
-	_ = dg.addDependenciesToGraph(g, root, sourceAppGUID)
-	if dg.graphHasCycles(g) {
-		return nil, errors.New("Graph has cycles and stack cannot be copied")
+	edges := len(dg.dependencies(g))
+	deferred := []DeferredBinding{}
+	cycles := dg.findCycles(g)
+	if len(cycles) > 0 {
+		if opts.Cycles != CyclesDefer {
+			return nil, &CycleError{Cycles: cycles}
+		}
+		g, deferred, err = dg.deferBindings(g)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Graph has no cycles after deferring %v binding(s)", len(deferred))
 	} else {
 		log.Infof("Graph has no cycles")
 	}
@@ -62,7 +142,123 @@ func (gr *GraphAPI) Discover(sourceAppGUID string) ([]types.Component, error) {
 		ret[len(sorted)-1-i] = (*node.Value).(types.Component)
 	}
 
-	return ret, nil
+	var waves [][]string
+	if opts.Waves {
+		waves = gr.groupIntoWaves(g, sorted)
+		log.Infof("Stack can be spawned in %v wave(s)", len(waves))
+	}
+
+	var details []DetailedComponent
+	if opts.Details {
+		details, err = dg.details(ret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stats := cache.Stats()
+	log.Infof("Cloud Controller calls: %v, cache hits: %v", stats.Calls, stats.Hits)
+	return &Discovery{
+		Components:       ret,
+		DeferredBindings: deferred,
+		Waves:            waves,
+		Details:          details,
+		Warnings:         append([]Warning{}, dg.warnings...),
+		Edges:            edges,
+		DependencyEdges:  append([]DependencyEdge{}, dg.edges...),
+		Cycles:           cycles,
+		Stats:            stats,
+	}, nil
+}
+
+// Diagram returns the whole dependency graph of application stack. Unlike Discover, it succeeds for graphs with cycles.
+// With CyclesDefer, bindings which would be deferred are marked as well.
+func (gr *GraphAPI) Diagram(sourceAppGUID string, opts Options) (*Diagram, error) {
+	dg, g, cache, err := gr.buildGraph(sourceAppGUID, opts)
+	if err != nil {
+		return nil, err
+	}
+	diagram := &Diagram{
+		Components:       []types.Component{},
+		Edges:            []Edge{},
+		Cycles:           dg.findCycles(g),
+		DeferredBindings: []DeferredBinding{},
+		Warnings:         append([]Warning{}, dg.warnings...),
+	}
+	if len(diagram.Cycles) > 0 && opts.Cycles == CyclesDefer {
+		if _, deferred, err := dg.deferBindings(g); err == nil {
+			diagram.DeferredBindings = deferred
+		}
+	}
+	for _, node := range g.TopologicalSort() {
+		diagram.Components = append(diagram.Components, (*node.Value).(types.Component))
+	}
+	for _, dep := range dg.dependencies(g) {
+		diagram.Edges = append(diagram.Edges, Edge{
+			From: (*dep.from.Value).(types.Component).GUID,
+			To:   (*dep.to.Value).(types.Component).GUID,
+		})
+	}
+	diagram.Stats = cache.Stats()
+	return diagram, nil
+}
+
+// buildGraph retrieves application stack from Cloud Controller and builds its dependency graph
+func (gr *GraphAPI) buildGraph(sourceAppGUID string, opts Options) (*DependencyGraph, *graph.Graph, *LookupCache, error) {
+	cache := NewLookupCache(gr.cf)
+	sourceAppSummary, err := cache.GetAppSummary(sourceAppGUID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if opts.CanReadSpace != nil {
+		allowed, err := opts.CanReadSpace(sourceAppSummary.SpaceGUID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !allowed {
+			return nil, nil, nil, &AccessError{AppGUID: sourceAppGUID, SpaceGUID: sourceAppSummary.SpaceGUID}
+		}
+	}
+
+	g := graph.New(graph.Directed)
+	dg := NewDependencyGraph(cache)
+	dg.tolerant = opts.Errors == ErrorsTolerant
+	dg.onEvent = opts.OnEvent
+	dg.canReadSpace = opts.CanReadSpace
+	dg.scanner = gr.Credentials
+	dg.envLinks = opts.EnvLinks
+	root := dg.NewNode(g, sourceAppGUID, sourceAppSummary.Name, types.ComponentApp, nil, true)
+	dg.fetchDependencies(sourceAppGUID, gr.Parallelism)
+	if err := dg.addDependenciesToGraph(g, root, sourceAppGUID); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(dg.warnings) > 0 {
+		log.Warnf("Discovery is partial, %v component(s) could not be expanded", len(dg.warnings))
+	}
+	return dg, g, cache, nil
+}
+
+// groupIntoWaves assigns every component to the wave following the latest wave of its dependencies.
+// Components without dependencies form the first wave. Graph has to be acyclic and sorted topologically.
+func (gr *GraphAPI) groupIntoWaves(g *graph.Graph, sorted []graph.Node) [][]string {
+	levels := make(map[graph.Node]int)
+	waves := [][]string{}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		node := sorted[i]
+		level := 0
+		for _, dependency := range g.Neighbors(node) {
+			if levels[dependency]+1 > level {
+				level = levels[dependency] + 1
+			}
+		}
+		levels[node] = level
+		for len(waves) <= level {
+			waves = append(waves, []string{})
+		}
+		waves[level] = append(waves[level], (*node.Value).(types.Component).GUID)
+	}
+	return waves
 }
 
 func (gr *GraphAPI) showNodeWithNeighbours(g *graph.Graph, node *graph.Node) string {
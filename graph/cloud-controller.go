@@ -0,0 +1,63 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/go-cf-lib/api"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"net/http"
+)
+
+// CloudController is the subset of Cloud Controller API used by dependency discovery.
+// It is satisfied by CfClient wrapping *api.CfAPI from go-cf-lib.
+type CloudController interface {
+	GetAppSummary(id string) (*types.CfAppSummary, error)
+	GetUserProvidedService(guid string) (*types.CfUserProvidedServiceResource, error)
+	GetSpaceRoutesForHostname(spaceGUID, hostname string) (*types.CfRoutesResponse, error)
+	GetAppsFromRoute(routeGUID string) (*types.CfAppsResponse, error)
+	GetSpace(guid string) (*types.CfSpaceResource, error)
+}
+
+// CfClient is go-cf-lib client with lookups it lacks
+type CfClient struct {
+	*api.CfAPI
+}
+
+// GetSpace retrieves space, to find its organization
+func (c CfClient) GetSpace(guid string) (*types.CfSpaceResource, error) {
+	address := fmt.Sprintf("%v/v2/spaces/%v", c.BaseAddress, guid)
+	log.Infof("Requesting space retrieval: %v", address)
+	resp, err := c.Get(address)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get space: [%v]", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.EntityNotFoundError
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Get space failed. Response from CC: %v", resp.Status)
+	}
+	toReturn := new(types.CfSpaceResource)
+	if err := json.NewDecoder(resp.Body).Decode(toReturn); err != nil {
+		return nil, err
+	}
+	return toReturn, nil
+}
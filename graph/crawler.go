@@ -0,0 +1,252 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"sync"
+)
+
+// DefaultParallelism is the default limit of concurrent Cloud Controller lookups in a single discovery
+const DefaultParallelism = 4
+
+// expansion holds everything retrieved from Cloud Controller to add dependencies of a single application
+type expansion struct {
+	summary *types.CfAppSummary
+	// User provided services bound to the application, by service GUID
+	services map[string]*boundService
+	// Applications which urls in environment of the application point to, if requested
+	envLinks []*link
+	envErr   error
+	err      error
+}
+
+// boundService is a user provided service bound to an application, with applications its credentials point to
+type boundService struct {
+	spaceGUID   string
+	credentials map[string]interface{}
+	// Every url found in credentials, in order of credential keys
+	links []*link
+	err   error
+}
+
+// link is an application which url in credentials of user provided service, or in environment
+// of application, points to. AppGUID is empty if the url does not match any application.
+type link struct {
+	url     string
+	appGUID string
+	appName string
+	// Credential or environment variable holding the url, and route of the application it matched
+	key    string
+	host   string
+	domain string
+}
+
+// crawler walks application stack fetching applications and user provided services concurrently.
+// Graph is not touched while crawling, it is built afterwards from retrieved expansions.
+type crawler struct {
+	dg         *DependencyGraph
+	slots      chan struct{}
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	expansions map[string]*expansion
+	// Nodes and edges already reported to event listener
+	reported map[string]bool
+}
+
+// fetchDependencies retrieves whole application stack starting from given application,
+// running up to parallelism lookups at once
+func (dg *DependencyGraph) fetchDependencies(sourceAppGUID string, parallelism int) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	c := &crawler{
+		dg:         dg,
+		slots:      make(chan struct{}, parallelism),
+		expansions: make(map[string]*expansion),
+		reported:   make(map[string]bool),
+	}
+	c.expand(sourceAppGUID)
+	c.wg.Wait()
+	dg.expansions = c.expansions
+}
+
+func (c *crawler) acquire() {
+	c.slots <- struct{}{}
+}
+
+func (c *crawler) release() {
+	<-c.slots
+}
+
+func (c *crawler) expand(appGUID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.expansions[appGUID]; ok {
+		return
+	}
+	exp := &expansion{services: make(map[string]*boundService)}
+	c.expansions[appGUID] = exp
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.acquire()
+		exp.summary, exp.err = c.dg.cf.GetAppSummary(appGUID)
+		c.release()
+		if exp.err != nil {
+			c.emit(Event{Type: EventError, GUID: appGUID, ComponentType: types.ComponentApp, Error: exp.err.Error()})
+			return
+		}
+		c.emitNode(appGUID, exp.summary.Name, types.ComponentApp)
+		for _, svc := range exp.summary.Services {
+			if c.dg.isNormalService(svc) {
+				c.emitNode(svc.GUID, svc.Name, types.ComponentService)
+				c.emitEdge(appGUID, svc.GUID)
+				continue
+			}
+			c.emitNode(svc.GUID, svc.Name, types.ComponentUPS)
+			c.emitEdge(appGUID, svc.GUID)
+			bound := &boundService{}
+			exp.services[svc.GUID] = bound
+			c.wg.Add(1)
+			go c.follow(exp.summary.SpaceGUID, svc, bound)
+		}
+		if c.dg.envLinks {
+			c.wg.Add(1)
+			go c.followEnv(appGUID, exp)
+		}
+	}()
+}
+
+// follow resolves applications pointed by user provided service and expands them
+func (c *crawler) follow(spaceGUID string, svc types.CfAppSummaryService, bound *boundService) {
+	defer c.wg.Done()
+	c.acquire()
+	*bound = *c.dg.getLinkedApps(spaceGUID, svc)
+	c.release()
+	if bound.err != nil {
+		log.Errorf("Failed to follow user provided service %v: %v", svc.Name, bound.err)
+	}
+	c.emitLinks(svc, bound)
+	if bound.err != nil {
+		return
+	}
+	for _, lnk := range bound.links {
+		if len(lnk.appGUID) > 0 {
+			c.expand(lnk.appGUID)
+		}
+	}
+}
+
+// followEnv resolves applications pointed by environment of the application and expands them
+func (c *crawler) followEnv(appGUID string, exp *expansion) {
+	defer c.wg.Done()
+	c.acquire()
+	exp.envLinks, exp.envErr = c.dg.getEnvLinkedApps(appGUID, exp.summary)
+	c.release()
+	event := Event{GUID: appGUID, Name: exp.summary.Name, ComponentType: types.ComponentApp}
+	if exp.envErr != nil {
+		log.Errorf("Failed to follow environment of application %v: %v", exp.summary.Name, exp.envErr)
+		event.Type = EventError
+		event.Error = exp.envErr.Error()
+		c.emit(event)
+		return
+	}
+	for _, lnk := range exp.envLinks {
+		event.URL, event.Variable = lnk.url, lnk.key
+		if len(lnk.appGUID) == 0 {
+			event.Type = EventURLMiss
+			c.emit(event)
+			continue
+		}
+		event.Type = EventURLMatch
+		event.AppGUID, event.AppName = lnk.appGUID, lnk.appName
+		c.emit(event)
+		event.AppGUID, event.AppName = "", ""
+		c.emitNode(lnk.appGUID, lnk.appName, types.ComponentApp)
+		c.emitEdge(appGUID, lnk.appGUID)
+		c.expand(lnk.appGUID)
+	}
+}
+
+// emitLinks reports result of matching urls of user provided service, unless it was already reported.
+// User provided service bound to many applications is followed once per binding, with the same result.
+func (c *crawler) emitLinks(svc types.CfAppSummaryService, bound *boundService) {
+	if c.dg.onEvent == nil || !c.firstReport("link "+svc.GUID) {
+		return
+	}
+	event := Event{GUID: svc.GUID, Name: svc.Name, ComponentType: types.ComponentUPS}
+	if bound.err != nil {
+		event.Type = EventError
+		event.Error = bound.err.Error()
+		c.emit(event)
+		return
+	}
+	if len(bound.links) == 0 {
+		event.Type = EventURLMiss
+		c.emit(event)
+		return
+	}
+	for _, lnk := range bound.links {
+		event.URL, event.CredentialKey = lnk.url, lnk.key
+		if len(lnk.appGUID) == 0 {
+			event.Type = EventURLMiss
+			c.emit(event)
+			continue
+		}
+		event.Type = EventURLMatch
+		event.AppGUID, event.AppName = lnk.appGUID, lnk.appName
+		c.emit(event)
+		event.AppGUID, event.AppName = "", ""
+		c.emitNode(lnk.appGUID, lnk.appName, types.ComponentApp)
+		c.emitEdge(svc.GUID, lnk.appGUID)
+	}
+}
+
+func (c *crawler) emit(event Event) {
+	if c.dg.onEvent != nil {
+		c.dg.onEvent(event)
+	}
+}
+
+// emitNode reports a component, unless it was already reported
+func (c *crawler) emitNode(guid, name string, typ types.ComponentType) {
+	if c.dg.onEvent == nil || !c.firstReport("node "+guid) {
+		return
+	}
+	c.emit(Event{Type: EventNode, GUID: guid, Name: name, ComponentType: typ})
+}
+
+// emitEdge reports a dependency, unless it was already reported
+func (c *crawler) emitEdge(from, to string) {
+	if c.dg.onEvent == nil || !c.firstReport("edge "+from+" "+to) {
+		return
+	}
+	c.emit(Event{Type: EventEdge, From: from, To: to})
+}
+
+func (c *crawler) firstReport(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reported[key] {
+		return false
+	}
+	c.reported[key] = true
+	return true
+}
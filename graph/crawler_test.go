@@ -0,0 +1,119 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// chainStack returns stack of given number of applications starting with root, each linked to the next one
+// and to the shared one
+func chainStack(length int) cftest.Stack {
+	shared := cftest.App{GUID: "shared-guid", Name: "shared", Routes: []cftest.Route{{Host: "shared"}}}
+	stack := cftest.Stack{Apps: []cftest.App{shared}}
+	stack.UserProvidedServices = append(stack.UserProvidedServices, cftest.Link("shared-ups-guid", "shared-ups", shared))
+	next := ""
+	for i := length - 1; i >= 0; i-- {
+		guid := fmt.Sprintf("app-%v-guid", i)
+		if i == 0 {
+			guid = "root-guid"
+		}
+		app := cftest.App{
+			GUID:     guid,
+			Name:     fmt.Sprintf("app-%v", i),
+			Routes:   []cftest.Route{{Host: fmt.Sprintf("app-%v", i)}},
+			Bindings: []string{"shared-ups-guid"},
+		}
+		if len(next) > 0 {
+			app.Bindings = append(app.Bindings, next+"-ups-guid")
+		}
+		stack.Apps = append(stack.Apps, app)
+		stack.UserProvidedServices = append(stack.UserProvidedServices, cftest.Link(app.GUID+"-ups-guid", app.Name+"-ups", app))
+		next = app.GUID
+	}
+	return stack
+}
+
+// discoverWithin runs discovery, failing the test if it does not finish in time
+func discoverWithin(t *testing.T, fake *cftest.Server, parallelism int, opts Options) []string {
+	done := make(chan []string, 1)
+	go func() {
+		graphAPI := NewGraphAPI(CfClient{CfAPI: fake.NewCfAPI()})
+		graphAPI.Parallelism = parallelism
+		discovery, err := graphAPI.Discover("root-guid", opts)
+		if err != nil {
+			t.Errorf("parallelism %v: %v", parallelism, err)
+			done <- nil
+			return
+		}
+		guids := []string{}
+		for _, component := range discovery.Components {
+			guids = append(guids, component.GUID)
+		}
+		done <- guids
+	}()
+	select {
+	case guids := <-done:
+		return guids
+	case <-time.After(10 * time.Second):
+		t.Fatalf("discovery with parallelism %v did not finish", parallelism)
+		return nil
+	}
+}
+
+func TestCrawlerOrderDoesNotDependOnParallelism(t *testing.T) {
+	tests := []struct {
+		name  string
+		stack cftest.Stack
+		opts  Options
+	}{
+		{"diamond", cftest.DiamondStack(), Options{}},
+		{"dangling", cftest.DanglingStack(), Options{}},
+		{"cycle", cftest.CycleStack(), Options{Cycles: CyclesDefer}},
+		{"chain", chainStack(12), Options{}},
+	}
+	for _, test := range tests {
+		fake := cftest.NewServer(test.stack)
+		expected := discoverWithin(t, fake, 1, test.opts)
+		for _, parallelism := range []int{2, 4, 16} {
+			for i := 0; i < 3; i++ {
+				if guids := discoverWithin(t, fake, parallelism, test.opts); !reflect.DeepEqual(guids, expected) {
+					t.Errorf("%v: parallelism %v changed order from %v to %v", test.name, parallelism, expected, guids)
+				}
+			}
+		}
+		fake.Close()
+	}
+}
+
+func TestCrawlerKeepsSequentialOrder(t *testing.T) {
+	fake := cftest.NewServer(cftest.DiamondStack())
+	defer fake.Close()
+
+	// Order in which components were listed before lookups were made concurrently
+	expected := []string{"db-guid", "shared-guid", "shared-ups-guid", "left-guid", "left-ups-guid",
+		"right-guid", "right-ups-guid", "root-guid"}
+	for _, parallelism := range []int{1, DefaultParallelism} {
+		if guids := discoverWithin(t, fake, parallelism, Options{}); !reflect.DeepEqual(guids, expected) {
+			t.Errorf("parallelism %v: expected order %v, got %v", parallelism, expected, guids)
+		}
+	}
+}
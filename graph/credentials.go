@@ -0,0 +1,120 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CredentialScanner finds urls in credentials of user provided services, under any key,
+// in nested objects and arrays. Keys are matched against glob patterns, ignoring case,
+// by their name or by their path, like backend.url.
+type CredentialScanner struct {
+	// If set, only values under keys matching any of these patterns are scanned
+	Allow []string
+	// Values under keys matching any of these patterns are never scanned
+	Deny []string
+}
+
+// ValidatePatterns returns error if any of the patterns is malformed
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid key pattern [%v]", pattern)
+		}
+	}
+	return nil
+}
+
+// credentialURL is an url found in credentials, with path of the key holding it
+type credentialURL struct {
+	key string
+	url string
+}
+
+// scan returns urls found in credentials, ordered by their keys. Urls in arrays are given with index, like urls[0].
+func (s CredentialScanner) scan(credentials map[string]interface{}) []credentialURL {
+	found := []credentialURL{}
+	s.scanValue(credentials, "", len(s.Allow) == 0, &found)
+	return found
+}
+
+func (s CredentialScanner) scanValue(value interface{}, keyPath string, allowed bool, found *[]credentialURL) {
+	switch typed := value.(type) {
+	case string:
+		if allowed && isURL(typed) {
+			*found = append(*found, credentialURL{key: keyPath, url: typed})
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			nested := key
+			if len(keyPath) > 0 {
+				nested = keyPath + "." + key
+			}
+			if matchesAny(s.Deny, key, nested) {
+				continue
+			}
+			s.scanValue(typed[key], nested, allowed || matchesAny(s.Allow, key, nested), found)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			s.scanValue(item, fmt.Sprintf("%v[%v]", keyPath, i), allowed, found)
+		}
+	}
+}
+
+// matchesAny tells whether key name or its path matches any of the patterns
+func matchesAny(patterns []string, name, keyPath string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, strings.ToLower(keyPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isURL tells whether value is an absolute http or https url with host, which may match a route of application.
+// Connection strings of databases and other services never point to applications.
+func isURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && len(parsed.Host) > 0
+}
+
+// redactURL returns url without user info, query and fragment, which may hold secrets,
+// so it can be shown in events, evidence of edges and logs
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	parsed.User = nil
+	parsed.RawQuery, parsed.Fragment, parsed.ForceQuery = "", "", false
+	return parsed.String()
+}
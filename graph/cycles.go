@@ -0,0 +1,46 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/go-cf-lib/types"
+)
+
+// Cycle describes a strongly connected component of dependency graph,
+// i.e. a group of components which depend on each other
+type Cycle struct {
+	Components []types.Component `json:"components"`
+	// Every edge in a cycle leads either from an application to user provided service bound to it,
+	// or from user provided service to an application which its url points to.
+	Edges []Edge `json:"edges"`
+}
+
+// CycleError is returned by discovery when application stack cannot be copied because of cycles
+type CycleError struct {
+	Cycles []Cycle
+	// Set when bindings were to be deferred, but some cycle goes only through links found in environment
+	// of applications, which cannot be deferred
+	Undeferrable bool
+}
+
+func (e *CycleError) Error() string {
+	if e.Undeferrable {
+		return "Graph has cycles which cannot be broken by deferring bindings, " +
+			"as links through environment of applications cannot be deferred"
+	}
+	return "Graph has cycles and stack cannot be copied"
+}
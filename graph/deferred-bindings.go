@@ -0,0 +1,149 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"github.com/twmb/algoimpl/go/graph"
+)
+
+// DeferredBinding is a binding of user provided service to an application,
+// which has to be created after all components of the stack exist
+type DeferredBinding struct {
+	AppGUID     string `json:"appGUID"`
+	ServiceGUID string `json:"serviceGUID"`
+}
+
+type dependency struct {
+	from, to graph.Node
+}
+
+// dependencies returns all edges of the graph, ordered by the time their start nodes were added
+func (dg *DependencyGraph) dependencies(g *graph.Graph) []dependency {
+	deps := []dependency{}
+	for _, node := range dg.order {
+		for _, neighbour := range g.Neighbors(node) {
+			deps = append(deps, dependency{from: node, to: neighbour})
+		}
+	}
+	return deps
+}
+
+func (dg *DependencyGraph) isDeferrable(dep dependency) bool {
+	from := (*dep.from.Value).(types.Component)
+	to := (*dep.to.Value).(types.Component)
+	return from.Type == types.ComponentApp && to.Type == types.ComponentUPS
+}
+
+// withoutDependencies builds a copy of the graph, skipping given edges.
+// Skipped bindings are also removed from DependencyOf lists of the copied components.
+func (dg *DependencyGraph) withoutDependencies(deps []dependency, skipped map[dependency]bool) *graph.Graph {
+	reduced := graph.New(graph.Directed)
+	copies := make(map[graph.Node]graph.Node)
+	for _, node := range dg.order {
+		component := (*node.Value).(types.Component)
+		component.DependencyOf = append([]string{}, component.DependencyOf...)
+		copied := reduced.MakeNode()
+		*copied.Value = component
+		copies[node] = copied
+	}
+	for _, dep := range deps {
+		if !skipped[dep] {
+			reduced.MakeEdgeWeight(copies[dep.from], copies[dep.to], 1)
+			continue
+		}
+		parentGUID := (*dep.from.Value).(types.Component).GUID
+		child := copies[dep.to]
+		component := (*child.Value).(types.Component)
+		dependencyOf := []string{}
+		for _, guid := range component.DependencyOf {
+			if guid != parentGUID {
+				dependencyOf = append(dependencyOf, guid)
+			}
+		}
+		component.DependencyOf = dependencyOf
+		*child.Value = component
+	}
+	return reduced
+}
+
+// firstCycle returns GUIDs of components forming any non-trivial strongly connected component
+func firstCycle(g *graph.Graph) map[string]bool {
+	for _, comp := range g.StronglyConnectedComponents() {
+		if len(comp) < 2 {
+			continue
+		}
+		members := make(map[string]bool)
+		for _, node := range comp {
+			members[(*node.Value).(types.Component).GUID] = true
+		}
+		return members
+	}
+	return nil
+}
+
+// deferBindings finds a minimal set of user provided service bindings, without which the graph is acyclic.
+// Returns copy of the graph without those bindings. If cycles cannot be broken that way, because they go
+// only through links found in environment of applications, undeferrable CycleError is returned.
+func (dg *DependencyGraph) deferBindings(g *graph.Graph) (*graph.Graph, []DeferredBinding, error) {
+	deps := dg.dependencies(g)
+	deferred := make(map[dependency]bool)
+	picked := []dependency{}
+
+	// Greedily defer the latest discovered binding in each remaining cycle.
+	// It is usually the one closing the loop back towards root application.
+	for {
+		members := firstCycle(dg.withoutDependencies(deps, deferred))
+		if members == nil {
+			break
+		}
+		candidate := -1
+		for i, dep := range deps {
+			from := (*dep.from.Value).(types.Component)
+			to := (*dep.to.Value).(types.Component)
+			if members[from.GUID] && members[to.GUID] && !deferred[dep] && dg.isDeferrable(dep) {
+				candidate = i
+			}
+		}
+		if candidate < 0 {
+			log.Errorf("Cycle cannot be broken by deferring bindings")
+			return nil, nil, &CycleError{Cycles: dg.findCycles(g), Undeferrable: true}
+		}
+		deferred[deps[candidate]] = true
+		picked = append(picked, deps[candidate])
+	}
+
+	// Drop bindings which turned out to be unnecessary once later ones got deferred
+	for i := len(picked) - 1; i >= 0; i-- {
+		delete(deferred, picked[i])
+		if firstCycle(dg.withoutDependencies(deps, deferred)) != nil {
+			deferred[picked[i]] = true
+		}
+	}
+
+	bindings := []DeferredBinding{}
+	for _, dep := range deps {
+		if deferred[dep] {
+			bindings = append(bindings, DeferredBinding{
+				AppGUID:     (*dep.from.Value).(types.Component).GUID,
+				ServiceGUID: (*dep.to.Value).(types.Component).GUID,
+			})
+		}
+	}
+	return dg.withoutDependencies(deps, deferred), bindings, nil
+}
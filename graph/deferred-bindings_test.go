@@ -0,0 +1,142 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"github.com/twmb/algoimpl/go/graph"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildTestGraph returns graph with edges like "root>db-ups", added in given order. Type of each component
+// is told by its name: "-ups" suffix is user provided service, "-svc" suffix is service, otherwise application.
+func buildTestGraph(edges ...string) (*DependencyGraph, *graph.Graph) {
+	dg := NewDependencyGraph(nil)
+	g := graph.New(graph.Directed)
+	node := func(guid string, parent *graph.Node) graph.Node {
+		var typ types.ComponentType = types.ComponentApp
+		if strings.HasSuffix(guid, "-ups") {
+			typ = types.ComponentUPS
+		} else if strings.HasSuffix(guid, "-svc") {
+			typ = types.ComponentService
+		}
+		return dg.NewNode(g, guid, guid, typ, parent, true)
+	}
+	for _, edge := range edges {
+		ends := strings.Split(edge, ">")
+		from := node(ends[0], nil)
+		to := node(ends[1], &from)
+		g.MakeEdgeWeight(from, to, 1)
+	}
+	return dg, g
+}
+
+// fewestDeferrable returns size of the smallest set of deferrable bindings breaking all cycles, found by brute force
+func fewestDeferrable(dg *DependencyGraph, g *graph.Graph) int {
+	deps := dg.dependencies(g)
+	deferrable := []dependency{}
+	for _, dep := range deps {
+		if dg.isDeferrable(dep) {
+			deferrable = append(deferrable, dep)
+		}
+	}
+	fewest := -1
+	for subset := 0; subset < 1<<uint(len(deferrable)); subset++ {
+		skipped := make(map[dependency]bool)
+		for i, dep := range deferrable {
+			if subset&(1<<uint(i)) != 0 {
+				skipped[dep] = true
+			}
+		}
+		if firstCycle(dg.withoutDependencies(deps, skipped)) == nil && (fewest < 0 || len(skipped) < fewest) {
+			fewest = len(skipped)
+		}
+	}
+	return fewest
+}
+
+func TestDeferBindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		edges    []string
+		deferred []DeferredBinding
+	}{
+		{"acyclic", []string{"root>backend-ups", "backend-ups>backend", "backend>db-svc"}, []DeferredBinding{}},
+		{"single cycle",
+			[]string{"root>backend-ups", "backend-ups>backend", "backend>root-ups", "root-ups>root"},
+			[]DeferredBinding{{AppGUID: "backend", ServiceGUID: "root-ups"}}},
+		{"two separate cycles",
+			[]string{"root>left-ups", "left-ups>left", "left>root-ups", "root-ups>root",
+				"root>right-ups", "right-ups>right", "right>back-ups", "back-ups>root"},
+			[]DeferredBinding{
+				{AppGUID: "left", ServiceGUID: "root-ups"},
+				{AppGUID: "right", ServiceGUID: "back-ups"},
+			}},
+		{"cycles sharing a binding",
+			[]string{"root>left-ups", "left-ups>left", "root>right-ups", "right-ups>right",
+				"left>shared-ups", "right>shared-ups", "shared-ups>shared", "shared>root-ups", "root-ups>root"},
+			[]DeferredBinding{{AppGUID: "shared", ServiceGUID: "root-ups"}}},
+		{"cycle closed by environment link",
+			[]string{"root>backend-ups", "backend-ups>backend", "backend>root"},
+			[]DeferredBinding{{AppGUID: "root", ServiceGUID: "backend-ups"}}},
+	}
+	for _, test := range tests {
+		dg, g := buildTestGraph(test.edges...)
+		reduced, deferred, err := dg.deferBindings(g)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(deferred, test.deferred) {
+			t.Errorf("%v: expected deferred bindings %v, got %v", test.name, test.deferred, deferred)
+		}
+		if firstCycle(reduced) != nil {
+			t.Errorf("%v: graph without deferred bindings still has a cycle", test.name)
+		}
+		if fewest := fewestDeferrable(dg, g); len(deferred) != fewest {
+			t.Errorf("%v: deferred %v bindings, while %v are enough", test.name, len(deferred), fewest)
+		}
+	}
+}
+
+func TestDeferBindingsUnbreakableCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []string
+	}{
+		{"environment links only", []string{"root>backend", "backend>root"}},
+		{"next to breakable cycle",
+			[]string{"root>left-ups", "left-ups>left", "left>root-ups", "root-ups>root", "root>right", "right>root"}},
+	}
+	for _, test := range tests {
+		dg, g := buildTestGraph(test.edges...)
+		_, _, err := dg.deferBindings(g)
+		cycleErr, ok := err.(*CycleError)
+		if !ok {
+			t.Errorf("%v: expected CycleError, got %v", test.name, err)
+			continue
+		}
+		if len(cycleErr.Cycles) == 0 {
+			t.Errorf("%v: CycleError lists no cycles", test.name)
+		}
+		if !cycleErr.Undeferrable || !strings.Contains(cycleErr.Error(), "environment") {
+			t.Errorf("%v: expected error telling environment links cannot be deferred, got %v", test.name, err)
+		}
+	}
+}
@@ -19,7 +19,6 @@ package graph
 import (
 	"fmt"
 	log "github.com/cihub/seelog"
-	"github.com/trustedanalytics/go-cf-lib/api"
 	"github.com/trustedanalytics/go-cf-lib/types"
 	"github.com/twmb/algoimpl/go/graph"
 	"net/url"
@@ -27,13 +26,29 @@ import (
 )
 
 type DependencyGraph struct {
-	cf    *api.CfAPI
+	cf    CloudController
 	nodes map[string]graph.Node
+	order []graph.Node
+	// Retrieved by fetchDependencies, by application GUID
+	expansions map[string]*expansion
+	// When tolerant, failures to retrieve dependencies are recorded as warnings instead of stopping discovery
+	tolerant bool
+	warnings []Warning
+	// Called concurrently while crawling, if set
+	onEvent func(Event)
+	// Tells whether the caller may read a space, if discovery is limited to spaces of the caller
+	canReadSpace func(spaceGUID string) (bool, error)
+	// Finds urls in credentials of user provided services
+	scanner CredentialScanner
+	// Whether urls in environment of applications link them to other applications
+	envLinks bool
+	// Dependencies added to the graph, in order they were added, with what made discovery add them
+	edges []DependencyEdge
 }
 
-func NewDependencyGraph() *DependencyGraph {
+func NewDependencyGraph(cf CloudController) *DependencyGraph {
 	toReturn := new(DependencyGraph)
-	toReturn.cf = api.NewCfAPI()
+	toReturn.cf = cf
 	toReturn.nodes = make(map[string]graph.Node)
 	return toReturn
 }
@@ -55,136 +70,349 @@ func (dg *DependencyGraph) NewNode(g *graph.Graph, guid, name string, typ types.
 	}
 	dg.appendAsDependency(&node, parent)
 	dg.nodes[guid] = node
+	dg.order = append(dg.order, node)
 	return node
 }
 
+// appendAsDependency adds parent to components the node is a dependency of, unless it is there already.
+// Parent reached through many paths is expanded for each of them, adding its dependencies again.
 func (dg *DependencyGraph) appendAsDependency(node *graph.Node, parent *graph.Node) {
 	if parent != nil {
 		dependencyOf := (*node.Value).(types.Component).DependencyOf
-		dependencyOf = append(dependencyOf, (*parent.Value).(types.Component).GUID)
+		parentGUID := (*parent.Value).(types.Component).GUID
+		for _, guid := range dependencyOf {
+			if guid == parentGUID {
+				return
+			}
+		}
+		dependencyOf = append(dependencyOf, parentGUID)
 		value := (*node.Value).(types.Component)
 		value.DependencyOf = dependencyOf
 		*node.Value = value
 	}
 }
 
+// addDependenciesToGraph adds dependencies of an application to the graph, recursively.
+// Application stack has to be retrieved with fetchDependencies first.
 func (dg *DependencyGraph) addDependenciesToGraph(g *graph.Graph, parent graph.Node, sourceAppGUID string) error {
 	log.Infof("addDependenciesToGraph for parent %v", *parent.Value)
-	sourceAppSummary, err := dg.cf.GetAppSummary(sourceAppGUID)
-	if err != nil {
-		return err
+	exp, ok := dg.expansions[sourceAppGUID]
+	if !ok {
+		return fmt.Errorf("Application %v was not retrieved", sourceAppGUID)
+	}
+	if exp.err != nil {
+		return dg.expansionFailed(parent, exp.err)
 	}
-	for _, svc := range sourceAppSummary.Services {
+	for _, svc := range exp.summary.Services {
 		if dg.isNormalService(svc) {
 			node := dg.NewNode(g, svc.GUID, svc.Name, types.ComponentService, &parent, true)
 			g.MakeEdgeWeight(parent, node, 1)
+			dg.recordEdge(DependencyEdge{From: sourceAppGUID, To: svc.GUID, Kind: EdgeBinding})
 		} else {
 			node := dg.NewNode(g, svc.GUID, svc.Name, types.ComponentUPS, &parent, true)
 			g.MakeEdgeWeight(parent, node, 1)
-			// Retrieve UPS
-			response, err := dg.cf.GetUserProvidedService(svc.GUID)
-			if err != nil {
-				return err
-			}
-			val, ok := response.Entity.Credentials["url"]
-			if !ok {
-				continue
-			}
-			urlStr, ok := val.(string)
-			if !ok {
+			dg.recordEdge(DependencyEdge{From: sourceAppGUID, To: svc.GUID, Kind: EdgeBinding})
+			bound := exp.services[svc.GUID]
+			if bound.err != nil {
+				if err := dg.expansionFailed(node, bound.err); err != nil {
+					return err
+				}
 				continue
 			}
-			appID, appName, err := dg.getAppIdAndNameFromSpaceByUrl(sourceAppSummary.SpaceGUID, urlStr)
-			if err != nil {
-				return err
-			}
-			if len(appID) > 0 {
-				log.Infof("Application %v is bound using %v", appID, svc.Name)
-				node2 := dg.NewNode(g, appID, appName, types.ComponentApp, &node, true)
+			linked := make(map[string]bool)
+			for _, lnk := range bound.links {
+				// Application pointed by many urls of the service depends on it once
+				if len(lnk.appGUID) == 0 || linked[lnk.appGUID] {
+					continue
+				}
+				linked[lnk.appGUID] = true
+				log.Infof("Application %v is bound using %v", lnk.appGUID, svc.Name)
+				node2 := dg.NewNode(g, lnk.appGUID, lnk.appName, types.ComponentApp, &node, true)
 				g.MakeEdgeWeight(node, node2, 1)
-				if dg.graphHasCycles(g) {
-					log.Errorf("Graph got cycle. Stopping graph traversing...")
-					break
+				dg.recordEdge(DependencyEdge{From: svc.GUID, To: lnk.appGUID, Kind: EdgeUPSURL, Evidence: &Evidence{
+					CredentialKey: lnk.key,
+					URL:           lnk.url,
+					Host:          lnk.host,
+					Domain:        lnk.domain,
+				}})
+				if dg.isReachable(g, node2, node) {
+					log.Errorf("Graph got cycle through %v. Skipping dependencies of %v...", svc.Name, lnk.appName)
+					continue
+				}
+				if err := dg.addDependenciesToGraph(g, node2, lnk.appGUID); err != nil {
+					return err
 				}
-				_ = dg.addDependenciesToGraph(g, node2, appID)
 			}
 		}
 	}
+	return dg.addEnvDependenciesToGraph(g, parent, sourceAppGUID, exp)
+}
+
+// addEnvDependenciesToGraph adds applications linked from environment of an application, recursively
+func (dg *DependencyGraph) addEnvDependenciesToGraph(g *graph.Graph, parent graph.Node, sourceAppGUID string,
+	exp *expansion) error {
+
+	if exp.envErr != nil {
+		return dg.expansionFailed(parent, exp.envErr)
+	}
+	linked := make(map[string]bool)
+	for _, lnk := range exp.envLinks {
+		if len(lnk.appGUID) == 0 || linked[lnk.appGUID] {
+			continue
+		}
+		linked[lnk.appGUID] = true
+		log.Infof("Application %v is linked from environment of %v", lnk.appGUID, sourceAppGUID)
+		node := dg.NewNode(g, lnk.appGUID, lnk.appName, types.ComponentApp, &parent, true)
+		g.MakeEdgeWeight(parent, node, 1)
+		dg.recordEdge(DependencyEdge{From: sourceAppGUID, To: lnk.appGUID, Kind: EdgeEnvURL, Evidence: &Evidence{
+			Variable: lnk.key,
+			URL:      lnk.url,
+			Host:     lnk.host,
+			Domain:   lnk.domain,
+		}})
+		if dg.isReachable(g, node, parent) {
+			log.Errorf("Graph got cycle through environment of %v. Skipping dependencies of %v...",
+				sourceAppGUID, lnk.appName)
+			continue
+		}
+		if err := dg.addDependenciesToGraph(g, node, lnk.appGUID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expansionFailed handles failure to retrieve dependencies of the node.
+// In tolerant mode it is recorded as a warning, otherwise an error stopping discovery is returned.
+// Token of the caller rejected by Cloud Controller always stops discovery.
+func (dg *DependencyGraph) expansionFailed(node graph.Node, err error) error {
+	if rejected, ok := err.(*TokenRejectedError); ok {
+		return rejected
+	}
+	component := (*node.Value).(types.Component)
+	log.Errorf("Failed to retrieve dependencies of %v %v: %v", component.Type, component.Name, err)
+	if !dg.tolerant {
+		return fmt.Errorf("Failed to retrieve dependencies of %v %v (%v): %v",
+			component.Type, component.Name, component.GUID, err)
+	}
+	for _, warning := range dg.warnings {
+		if warning.GUID == component.GUID {
+			return nil
+		}
+	}
+	dg.warnings = append(dg.warnings, Warning{
+		GUID:  component.GUID,
+		Name:  component.Name,
+		Type:  component.Type,
+		Error: err.Error(),
+	})
 	return nil
 }
 
-func (dg *DependencyGraph) graphHasCycles(g *graph.Graph) bool {
-	components := g.StronglyConnectedComponents()
-	for _, comp := range components {
-		if len(comp) > 1 {
-			log.Warnf("Cycle of length %v", len(comp))
+// getLinkedApps returns user provided service with applications which urls in its credentials point to.
+// Link with empty GUID is returned for url which does not match any application in the space.
+func (dg *DependencyGraph) getLinkedApps(spaceGUID string, svc types.CfAppSummaryService) *boundService {
+	toReturn := new(boundService)
+	// Retrieve UPS
+	response, err := dg.cf.GetUserProvidedService(svc.GUID)
+	if err != nil {
+		toReturn.err = err
+		return toReturn
+	}
+	toReturn.spaceGUID = response.Entity.SpaceGUID
+	toReturn.credentials = response.Entity.Credentials
+	for _, found := range dg.scanner.scan(response.Entity.Credentials) {
+		// Credentials hold secrets, urls are shown redacted
+		lnk := &link{url: redactURL(found.url), key: found.key}
+		match, err := dg.getAppFromSpaceByUrl(spaceGUID, lnk.url)
+		if err != nil {
+			toReturn.err = err
+			return toReturn
+		}
+		if match != nil {
+			lnk.appGUID, lnk.appName = match.appGUID, match.appName
+			lnk.host, lnk.domain = match.route.Host, match.route.Domain.Name
+		}
+		if err := dg.checkLinkedSpace(lnk); err != nil {
+			toReturn.err = err
+			return toReturn
+		}
+		toReturn.links = append(toReturn.links, lnk)
+	}
+	return toReturn
+}
+
+// getEnvLinkedApps returns applications which urls in environment of the application point to.
+// Link with empty GUID is returned for url which does not match any application in the space.
+// Urls of the application itself are skipped.
+func (dg *DependencyGraph) getEnvLinkedApps(appGUID string, summary *types.CfAppSummary) ([]*link, error) {
+	links := []*link{}
+	for _, found := range (CredentialScanner{}).scan(summary.Envs) {
+		// Environment holds secrets too, urls are shown redacted
+		lnk := &link{url: redactURL(found.url), key: found.key}
+		match, err := dg.getAppFromSpaceByUrl(summary.SpaceGUID, lnk.url)
+		if err != nil {
+			return nil, err
+		}
+		if match != nil {
+			if match.appGUID == appGUID {
+				continue
+			}
+			lnk.appGUID, lnk.appName = match.appGUID, match.appName
+			lnk.host, lnk.domain = match.route.Host, match.route.Domain.Name
+		}
+		if err := dg.checkLinkedSpace(lnk); err != nil {
+			return nil, err
+		}
+		links = append(links, lnk)
+	}
+	return links, nil
+}
+
+// checkLinkedSpace leaves out application the link points to, if the caller cannot read its space
+func (dg *DependencyGraph) checkLinkedSpace(lnk *link) error {
+	if dg.canReadSpace == nil || len(lnk.appGUID) == 0 {
+		return nil
+	}
+	summary, err := dg.cf.GetAppSummary(lnk.appGUID)
+	if err != nil {
+		return err
+	}
+	allowed, err := dg.canReadSpace(summary.SpaceGUID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		log.Infof("Leaving out application %v linked by %v, caller cannot read space %v",
+			lnk.appGUID, lnk.url, summary.SpaceGUID)
+		lnk.appGUID, lnk.appName, lnk.host, lnk.domain = "", "", "", ""
+	}
+	return nil
+}
+
+// isReachable tells whether there is a path from one node to another
+func (dg *DependencyGraph) isReachable(g *graph.Graph, from, to graph.Node) bool {
+	visited := map[graph.Node]bool{from: true}
+	stack := []graph.Node{from}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == to {
 			return true
 		}
+		for _, neighbour := range g.Neighbors(node) {
+			if !visited[neighbour] {
+				visited[neighbour] = true
+				stack = append(stack, neighbour)
+			}
+		}
 	}
 	return false
 }
 
+// findCycles returns all non-trivial strongly connected components of the graph.
+// Members of each cycle are listed in order they were added to the graph.
+func (dg *DependencyGraph) findCycles(g *graph.Graph) []Cycle {
+	cycles := []Cycle{}
+	for _, comp := range g.StronglyConnectedComponents() {
+		if len(comp) < 2 {
+			continue
+		}
+		log.Warnf("Cycle of length %v", len(comp))
+		members := make(map[graph.Node]bool)
+		for _, node := range comp {
+			members[node] = true
+		}
+		cycle := Cycle{Components: []types.Component{}, Edges: []Edge{}}
+		for _, node := range dg.order {
+			if !members[node] {
+				continue
+			}
+			from := (*node.Value).(types.Component)
+			cycle.Components = append(cycle.Components, from)
+			for _, neighbour := range g.Neighbors(node) {
+				if members[neighbour] {
+					to := (*neighbour.Value).(types.Component)
+					cycle.Edges = append(cycle.Edges, Edge{From: from.GUID, To: to.GUID})
+				}
+			}
+		}
+		cycles = append(cycles, cycle)
+	}
+	return cycles
+}
+
 func (dg *DependencyGraph) isNormalService(svc types.CfAppSummaryService) bool {
 	// Normal services require plan.
 	// User provided services does not support Plans so this field is empty then.
 	return len(svc.Plan.Service.Label) > 0
 }
 
-func (dg *DependencyGraph) getAppIdAndNameFromSpaceByUrl(spaceGUID, urlStr string) (string, string, error) {
+// urlMatch is an application with route matching an url
+type urlMatch struct {
+	appGUID string
+	appName string
+	route   types.CfAppSummaryRoute
+}
+
+// getAppFromSpaceByUrl returns application in the space with route matching the url, or nil if there is none
+func (dg *DependencyGraph) getAppFromSpaceByUrl(spaceGUID, urlStr string) (*urlMatch, error) {
 	appURL, err := url.Parse(urlStr)
 	if err != nil {
 		log.Infof("[%v] is not a correct URL. Parsing failed.", urlStr)
-		return "", "", err
+		return nil, err
 	}
 	log.Infof("URL Host %v", appURL.Host)
 	routes, err := dg.cf.GetSpaceRoutesForHostname(spaceGUID, strings.Split(appURL.Host, ".")[0])
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 	if routes.Count == 0 {
 		log.Infof("No routes found for host: %v", appURL.Host)
-		return "", "", nil
+		return nil, nil
 	}
 	log.Infof("%v route(s) retrieved for host %v", routes.Count, appURL.Host)
 	routeGUID := routes.Resources[0].Meta.GUID
 	apps, err := dg.cf.GetAppsFromRoute(routeGUID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 	if apps.Count == 0 {
 		log.Infof("No apps bound to route: [%v]", routeGUID)
-		return "", "", nil
+		return nil, nil
 	}
 	app := apps.Resources[0]
 	log.Debugf("App %+v", app)
-	wasFound, err := dg.doesUrlMatchApplication(urlStr, app.Meta.GUID)
+	route, err := dg.findMatchingRoute(urlStr, app.Meta.GUID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	if !wasFound {
+	if route == nil {
 		log.Infof("url of found app does not match url in user provided service")
-		return "", "", nil
+		return nil, nil
 
 	}
 	log.Infof("Found app match url in user provided service")
-	return app.Meta.GUID, app.Entity.Name, nil
+	return &urlMatch{appGUID: app.Meta.GUID, appName: app.Entity.Name, route: *route}, nil
 }
 
-func (dg *DependencyGraph) doesUrlMatchApplication(appUrlStr, appID string) (bool, error) {
+// findMatchingRoute returns route of the application whose host and domain are the host of the url,
+// or nil if there is none
+func (dg *DependencyGraph) findMatchingRoute(appUrlStr, appID string) (*types.CfAppSummaryRoute, error) {
 	appURL, err := url.Parse(appUrlStr)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	appSummary, err := dg.cf.GetAppSummary(appID)
 	log.Debugf("App summary retrieved is [%+v]", appSummary)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	for i := range appSummary.Routes {
 		route := appSummary.Routes[i]
 		if appURL.Host == fmt.Sprintf("%v.%v", route.Host, route.Domain.Name) {
-			return true, nil
+			return &route, nil
 		}
 	}
-	return false, nil
+	return nil, nil
 }
@@ -0,0 +1,172 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"fmt"
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/go-cf-lib/types"
+)
+
+// RedactedValue replaces values of user provided service credentials in component details
+const RedactedValue = "***"
+
+// DetailedComponent is a component with details needed to clone it, taken from Cloud Controller responses
+// retrieved during discovery. Only details of its type are set.
+type DetailedComponent struct {
+	types.Component
+	App                 *AppDetails                 `json:"app,omitempty"`
+	Service             *ServiceDetails             `json:"service,omitempty"`
+	UserProvidedService *UserProvidedServiceDetails `json:"userProvidedService,omitempty"`
+}
+
+// AppDetails describes an application. Memory and disk quota are given in megabytes.
+type AppDetails struct {
+	SpaceGUID string `json:"spaceGUID"`
+	// Organization of the space. It is empty when the space could not be retrieved in tolerant mode.
+	OrganizationGUID string     `json:"organizationGUID"`
+	State            string     `json:"state"`
+	Memory           int64      `json:"memory"`
+	DiskQuota        int64      `json:"diskQuota"`
+	Instances        int        `json:"instances"`
+	Buildpack        string     `json:"buildpack"`
+	Command          string     `json:"command"`
+	Routes           []AppRoute `json:"routes"`
+}
+
+// AppRoute is a route mapped to an application
+type AppRoute struct {
+	Host   string `json:"host"`
+	Domain string `json:"domain"`
+}
+
+// ServiceDetails describes a managed service instance by its service label and plan
+type ServiceDetails struct {
+	Label string `json:"label"`
+	Plan  string `json:"plan"`
+}
+
+// UserProvidedServiceDetails describes a user provided service. Only keys of its credentials are given,
+// values are replaced with RedactedValue.
+type UserProvidedServiceDetails struct {
+	SpaceGUID string `json:"spaceGUID"`
+	// Organization of the space. It is empty when the space could not be retrieved in tolerant mode.
+	OrganizationGUID string            `json:"organizationGUID"`
+	Credentials      map[string]string `json:"credentials"`
+}
+
+// details returns given components with details found in application summaries and user provided services
+// retrieved by fetchDependencies. Details of components which could not be retrieved are missing.
+// Organizations are found by retrieving spaces of applications and user provided services.
+func (dg *DependencyGraph) details(components []types.Component) ([]DetailedComponent, error) {
+	apps := make(map[string]*types.CfAppSummary)
+	services := make(map[string]types.CfAppSummaryService)
+	bound := make(map[string]*boundService)
+	for guid, exp := range dg.expansions {
+		if exp.summary == nil {
+			continue
+		}
+		apps[guid] = exp.summary
+		for _, svc := range exp.summary.Services {
+			services[svc.GUID] = svc
+		}
+		for guid, ups := range exp.services {
+			if ups.credentials != nil {
+				bound[guid] = ups
+			}
+		}
+	}
+
+	toReturn := make([]DetailedComponent, len(components))
+	for i, component := range components {
+		toReturn[i].Component = component
+		switch component.Type {
+		case types.ComponentApp:
+			if summary, ok := apps[component.GUID]; ok {
+				toReturn[i].App = appDetails(summary)
+				org, err := dg.organization(component, summary.SpaceGUID)
+				if err != nil {
+					return nil, err
+				}
+				toReturn[i].App.OrganizationGUID = org
+			}
+		case types.ComponentService:
+			if svc, ok := services[component.GUID]; ok {
+				toReturn[i].Service = &ServiceDetails{Label: svc.Plan.Service.Label, Plan: svc.Plan.Name}
+			}
+		case types.ComponentUPS:
+			if ups, ok := bound[component.GUID]; ok {
+				org, err := dg.organization(component, ups.spaceGUID)
+				if err != nil {
+					return nil, err
+				}
+				toReturn[i].UserProvidedService = &UserProvidedServiceDetails{
+					SpaceGUID:        ups.spaceGUID,
+					OrganizationGUID: org,
+					Credentials:      redact(ups.credentials),
+				}
+			}
+		}
+	}
+	return toReturn, nil
+}
+
+// organization returns GUID of organization of the space holding the component.
+// In tolerant mode failure to retrieve the space is recorded as a warning and empty GUID is returned.
+func (dg *DependencyGraph) organization(component types.Component, spaceGUID string) (string, error) {
+	space, err := dg.cf.GetSpace(spaceGUID)
+	if err == nil {
+		return space.Entity.OrgGUID, nil
+	}
+	log.Errorf("Failed to retrieve organization of %v %v: %v", component.Type, component.Name, err)
+	if !dg.tolerant {
+		return "", fmt.Errorf("Failed to retrieve organization of %v %v (%v) from space %v: %v",
+			component.Type, component.Name, component.GUID, spaceGUID, err)
+	}
+	dg.warnings = append(dg.warnings, Warning{
+		GUID:  component.GUID,
+		Name:  component.Name,
+		Type:  component.Type,
+		Error: fmt.Sprintf("Failed to retrieve organization from space %v: %v", spaceGUID, err),
+	})
+	return "", nil
+}
+
+func appDetails(summary *types.CfAppSummary) *AppDetails {
+	toReturn := &AppDetails{
+		SpaceGUID: summary.SpaceGUID,
+		State:     summary.State,
+		Memory:    summary.Memory,
+		DiskQuota: summary.DiskQuota,
+		Instances: summary.InstanceCount,
+		Buildpack: summary.BuildpackUrl,
+		Command:   summary.Command,
+		Routes:    []AppRoute{},
+	}
+	for _, route := range summary.Routes {
+		toReturn.Routes = append(toReturn.Routes, AppRoute{Host: route.Host, Domain: route.Domain.Name})
+	}
+	return toReturn
+}
+
+func redact(credentials map[string]interface{}) map[string]string {
+	toReturn := make(map[string]string, len(credentials))
+	for key := range credentials {
+		toReturn[key] = RedactedValue
+	}
+	return toReturn
+}
@@ -0,0 +1,95 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/go-cf-lib/types"
+)
+
+// Edge is a dependency of one component on another
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Diagram is the dependency graph of application stack, complete with its cycles
+type Diagram struct {
+	// Components in topological order, dependent ones first
+	Components []types.Component
+	Edges      []Edge
+	Cycles     []Cycle
+	// Bindings which would be deferred to break cycles
+	DeferredBindings []DeferredBinding
+	Warnings         []Warning
+	Stats            LookupStats
+}
+
+func (d *Diagram) component(guid string) types.Component {
+	for _, component := range d.Components {
+		if component.GUID == guid {
+			return component
+		}
+	}
+	return types.Component{GUID: guid}
+}
+
+// isInCycle tells whether component is a member of any cycle
+func (d *Diagram) isInCycle(guid string) bool {
+	for _, cycle := range d.Cycles {
+		for _, component := range cycle.Components {
+			if component.GUID == guid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isCycleEdge tells whether edge belongs to any cycle
+func (d *Diagram) isCycleEdge(edge Edge) bool {
+	for _, cycle := range d.Cycles {
+		for _, cycleEdge := range cycle.Edges {
+			if cycleEdge == edge {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *Diagram) isDeferred(edge Edge) bool {
+	for _, binding := range d.DeferredBindings {
+		if binding.AppGUID == edge.From && binding.ServiceGUID == edge.To {
+			return true
+		}
+	}
+	return false
+}
+
+// edgeLabel names the binding or user provided service which makes the dependency,
+// or tells that application is linked from environment of another one
+func (d *Diagram) edgeLabel(edge Edge) string {
+	from := d.component(edge.From)
+	to := d.component(edge.To)
+	switch {
+	case from.Type == types.ComponentUPS:
+		return from.Name
+	case from.Type == types.ComponentApp && to.Type == types.ComponentApp:
+		return "env"
+	}
+	return to.Name
+}
@@ -0,0 +1,85 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"io"
+	"strings"
+)
+
+const cycleColor = "red"
+
+var dotShapes = map[types.ComponentType]string{
+	types.ComponentApp:     "box",
+	types.ComponentService: "cylinder",
+	types.ComponentUPS:     "hexagon",
+}
+
+// WriteDOT renders the diagram in Graphviz DOT language.
+// Applications, services and user provided services have different shapes,
+// edges are labelled with the binding or user provided service name, or env, cycles are drawn in red
+// and deferred bindings are dashed.
+func (d *Diagram) WriteDOT(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	name := "stack"
+	if len(d.Components) > 0 {
+		name = d.Components[0].Name
+	}
+	fmt.Fprintf(out, "digraph %v {\n", dotQuote(name))
+	fmt.Fprintf(out, "  node [fontname=\"Helvetica\"];\n")
+	fmt.Fprintf(out, "  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, component := range d.Components {
+		attrs := []string{
+			"label=" + dotQuote(component.Name),
+			"shape=" + dotShape(component.Type),
+			"tooltip=" + dotQuote(fmt.Sprintf("%v %v", component.Type, component.GUID)),
+		}
+		if d.isInCycle(component.GUID) {
+			attrs = append(attrs, "color="+cycleColor, "fontcolor="+cycleColor, "penwidth=2")
+		}
+		fmt.Fprintf(out, "  %v [%v];\n", dotQuote(component.GUID), strings.Join(attrs, ", "))
+	}
+	for _, edge := range d.Edges {
+		attrs := []string{"label=" + dotQuote(d.edgeLabel(edge))}
+		if d.isCycleEdge(edge) {
+			attrs = append(attrs, "color="+cycleColor, "fontcolor="+cycleColor, "penwidth=2")
+		}
+		if d.isDeferred(edge) {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(out, "  %v -> %v [%v];\n", dotQuote(edge.From), dotQuote(edge.To), strings.Join(attrs, ", "))
+	}
+	fmt.Fprintf(out, "}\n")
+	return out.Flush()
+}
+
+func dotShape(typ types.ComponentType) string {
+	if shape, ok := dotShapes[typ]; ok {
+		return shape
+	}
+	return "ellipse"
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
@@ -0,0 +1,60 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+// EdgeKind tells why one component depends on another
+// swagger:enum EdgeKind
+type EdgeKind string
+
+const (
+	// EdgeBinding is a service or user provided service bound to application
+	EdgeBinding EdgeKind = "binding"
+	// EdgeUPSURL is an application whose route matches url in credentials of user provided service
+	EdgeUPSURL EdgeKind = "ups-url"
+	// EdgeEnvURL is an application whose route matches url in environment of another application
+	EdgeEnvURL EdgeKind = "env-url"
+)
+
+// DependencyEdge is a dependency of one component on another, with what made discovery find it
+type DependencyEdge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+	// Set for links found in credentials or environment, not for bindings
+	Evidence *Evidence `json:"evidence,omitempty"`
+}
+
+// Evidence is the credential or environment variable whose url matched a route of application, and the route.
+// Url is given without user info, query and fragment.
+type Evidence struct {
+	CredentialKey string `json:"credentialKey,omitempty"`
+	Variable      string `json:"variable,omitempty"`
+	URL           string `json:"url"`
+	Host          string `json:"host"`
+	Domain        string `json:"domain"`
+}
+
+// recordEdge remembers dependency added to the graph. Dependency added again, when its source is reached
+// through another path, is recorded once.
+func (dg *DependencyGraph) recordEdge(edge DependencyEdge) {
+	for _, recorded := range dg.edges {
+		if recorded.From == edge.From && recorded.To == edge.To {
+			return
+		}
+	}
+	dg.edges = append(dg.edges, edge)
+}
@@ -0,0 +1,66 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoveryEdges(t *testing.T) {
+	stack := cftest.DiamondStack()
+	right := "http://right." + cftest.DefaultDomain + "/api"
+	for i, ups := range stack.UserProvidedServices {
+		if ups.GUID == "right-ups-guid" {
+			stack.UserProvidedServices[i].Credentials = map[string]interface{}{
+				"backend": map[string]interface{}{"url": right, "timeout": "30s"},
+			}
+		}
+	}
+	fake := cftest.NewServer(stack)
+	defer fake.Close()
+
+	discovery, err := NewGraphAPI(CfClient{CfAPI: fake.NewCfAPI()}).Discover("root-guid", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	urlEvidence := func(key, url, host string) *Evidence {
+		return &Evidence{CredentialKey: key, URL: url, Host: host, Domain: cftest.DefaultDomain}
+	}
+	// Edges are listed depth first, in order discovery found them
+	expected := []DependencyEdge{
+		{"root-guid", "left-ups-guid", EdgeBinding, nil},
+		{"left-ups-guid", "left-guid", EdgeUPSURL, urlEvidence("url", "http://left."+cftest.DefaultDomain, "left")},
+		{"left-guid", "db-guid", EdgeBinding, nil},
+		{"left-guid", "shared-ups-guid", EdgeBinding, nil},
+		{"shared-ups-guid", "shared-guid", EdgeUPSURL, urlEvidence("url", "http://shared."+cftest.DefaultDomain, "shared")},
+		{"root-guid", "right-ups-guid", EdgeBinding, nil},
+		{"right-ups-guid", "right-guid", EdgeUPSURL, urlEvidence("backend.url", right, "right")},
+		{"right-guid", "db-guid", EdgeBinding, nil},
+		{"right-guid", "shared-ups-guid", EdgeBinding, nil},
+	}
+	if len(discovery.DependencyEdges) != len(expected) {
+		t.Fatalf("expected %v edges, got %v: %+v", len(expected), len(discovery.DependencyEdges), discovery.DependencyEdges)
+	}
+	for i, edge := range discovery.DependencyEdges {
+		if !reflect.DeepEqual(edge, expected[i]) {
+			t.Errorf("edge %v: expected %+v with evidence %+v, got %+v with evidence %+v",
+				i, expected[i], expected[i].Evidence, edge, edge.Evidence)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/go-cf-lib/types"
+)
+
+// EventType names a step of discovery reported to Options.OnEvent
+type EventType string
+
+const (
+	// EventNode is emitted when a component of the stack is found
+	EventNode EventType = "node"
+	// EventEdge is emitted when a dependency between two components is found
+	EventEdge EventType = "edge"
+	// EventURLMatch is emitted for every url of a user provided service, or in environment of an application,
+	// pointing to an application in its space
+	EventURLMatch EventType = "url-match"
+	// EventURLMiss is emitted for every url of a user provided service, or in environment of an application,
+	// not pointing to any application. User provided service without urls is reported once, without url.
+	EventURLMiss EventType = "url-miss"
+	// EventError is emitted when an application or user provided service cannot be retrieved
+	EventError EventType = "error"
+)
+
+// Event reports progress of a discovery while application stack is being retrieved from Cloud Controller.
+// Nodes and edges are reported as soon as they are found, each one once, so they may come in any order.
+type Event struct {
+	Type EventType `json:"-"`
+	// Component which is found, matched or failed
+	GUID          string              `json:"GUID,omitempty"`
+	Name          string              `json:"name,omitempty"`
+	ComponentType types.ComponentType `json:"type,omitempty"`
+	// Dependency which is found
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Url of user provided service or application, without user info, query and fragment,
+	// credential key or environment variable holding it, and application it points to
+	URL           string `json:"url,omitempty"`
+	CredentialKey string `json:"credentialKey,omitempty"`
+	Variable      string `json:"variable,omitempty"`
+	AppGUID       string `json:"appGUID,omitempty"`
+	AppName       string `json:"appName,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
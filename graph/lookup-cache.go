@@ -0,0 +1,144 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"fmt"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"sync"
+)
+
+// LookupStats counts Cloud Controller lookups made through LookupCache
+type LookupStats struct {
+	// Calls is the number of lookups passed to Cloud Controller
+	Calls int
+	// Hits is the number of lookups answered from cache
+	Hits int
+}
+
+// HitRatio returns fraction of lookups answered from cache
+func (s LookupStats) HitRatio() float64 {
+	if s.Calls+s.Hits == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Calls+s.Hits)
+}
+
+// LookupCache is a CloudController remembering responses of the wrapped one.
+// It is meant to live as long as a single discovery, so it never expires entries.
+// Concurrent lookups of the same entity wait for a single Cloud Controller call.
+// Failed lookups are not remembered. Returned values are shared and must not be modified.
+type LookupCache struct {
+	cf      CloudController
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	stats   LookupStats
+}
+
+type cacheEntry struct {
+	ready chan struct{}
+	value interface{}
+	err   error
+}
+
+func NewLookupCache(cf CloudController) *LookupCache {
+	toReturn := new(LookupCache)
+	toReturn.cf = cf
+	toReturn.entries = make(map[string]*cacheEntry)
+	return toReturn
+}
+
+// Stats returns number of calls and cache hits so far
+func (c *LookupCache) Stats() LookupStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *LookupCache) GetAppSummary(id string) (*types.CfAppSummary, error) {
+	value, err := c.lookup("app summary "+id, func() (interface{}, error) {
+		return c.cf.GetAppSummary(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*types.CfAppSummary), nil
+}
+
+func (c *LookupCache) GetUserProvidedService(guid string) (*types.CfUserProvidedServiceResource, error) {
+	value, err := c.lookup("user provided service "+guid, func() (interface{}, error) {
+		return c.cf.GetUserProvidedService(guid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*types.CfUserProvidedServiceResource), nil
+}
+
+func (c *LookupCache) GetSpaceRoutesForHostname(spaceGUID, hostname string) (*types.CfRoutesResponse, error) {
+	key := fmt.Sprintf("space routes %v %v", spaceGUID, hostname)
+	value, err := c.lookup(key, func() (interface{}, error) {
+		return c.cf.GetSpaceRoutesForHostname(spaceGUID, hostname)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*types.CfRoutesResponse), nil
+}
+
+func (c *LookupCache) GetAppsFromRoute(routeGUID string) (*types.CfAppsResponse, error) {
+	value, err := c.lookup("route apps "+routeGUID, func() (interface{}, error) {
+		return c.cf.GetAppsFromRoute(routeGUID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*types.CfAppsResponse), nil
+}
+
+func (c *LookupCache) GetSpace(guid string) (*types.CfSpaceResource, error) {
+	value, err := c.lookup("space "+guid, func() (interface{}, error) {
+		return c.cf.GetSpace(guid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*types.CfSpaceResource), nil
+}
+
+func (c *LookupCache) lookup(key string, call func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		c.stats.Hits++
+		c.mu.Unlock()
+		<-entry.ready
+		return entry.value, entry.err
+	}
+	entry := &cacheEntry{ready: make(chan struct{})}
+	c.entries[key] = entry
+	c.stats.Calls++
+	c.mu.Unlock()
+
+	entry.value, entry.err = call()
+	if entry.err != nil {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+	}
+	close(entry.ready)
+	return entry.value, entry.err
+}
@@ -0,0 +1,71 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"sync"
+	"testing"
+)
+
+func TestLookupCacheMemoizes(t *testing.T) {
+	fake := cftest.NewServer(cftest.DiamondStack())
+	defer fake.Close()
+	fake.Fail("/v2/user_provided_service_instances/left-ups-guid")
+	cache := NewLookupCache(CfClient{CfAPI: fake.NewCfAPI()})
+	fake.ResetCalls()
+
+	// Concurrent lookups of the same entity wait for a single call
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.GetAppSummary("root-guid"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	// Failed lookups are repeated
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetUserProvidedService("left-ups-guid"); err == nil {
+			t.Errorf("expected lookup of failing user provided service to fail")
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetSpace(cftest.DefaultSpaceGUID); err != nil {
+			t.Error(err)
+		}
+	}
+
+	tests := []struct {
+		endpoint string
+		calls    int
+	}{
+		{cftest.EndpointAppSummary, 1},
+		{cftest.EndpointSpace, 1},
+	}
+	for _, test := range tests {
+		if calls := fake.Calls(test.endpoint); calls != test.calls {
+			t.Errorf("%v: expected %v call(s), got %v", test.endpoint, test.calls, calls)
+		}
+	}
+	if stats, expected := cache.Stats(), (LookupStats{Calls: 4, Hits: 11}); stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, stats)
+	}
+}
@@ -0,0 +1,247 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"io"
+	"sort"
+)
+
+const (
+	svgNodeHeight    = 40
+	svgMinNodeWidth  = 100
+	svgCharWidth     = 7
+	svgHorizontalGap = 40
+	svgVerticalGap   = 80
+	svgMargin        = 20
+	svgLegendHeight  = 30
+	svgCycleColor    = "#d62728"
+	svgEdgeColor     = "#555555"
+)
+
+var svgColors = map[types.ComponentType]string{
+	types.ComponentApp:     "#4e79a7",
+	types.ComponentService: "#59a14f",
+	types.ComponentUPS:     "#f28e2b",
+}
+
+type svgNode struct {
+	component   types.Component
+	layer       int
+	position    float64
+	x, y, width int
+}
+
+func (n *svgNode) centerX() int {
+	return n.x + n.width/2
+}
+
+type byPosition []*svgNode
+
+func (p byPosition) Len() int           { return len(p) }
+func (p byPosition) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byPosition) Less(i, j int) bool { return p[i].position < p[j].position }
+
+// WriteSVG renders the diagram as SVG image. Components are laid out in layers following topological order,
+// so every component is drawn below all components depending on it (except for edges closing cycles).
+// Applications, services and user provided services have different colours,
+// cycles are drawn in red and deferred bindings are dashed.
+func (d *Diagram) WriteSVG(w io.Writer) error {
+	nodes, layers := d.layout()
+
+	width, height := 0, svgMargin
+	for _, layer := range layers {
+		layerWidth := svgMargin
+		for _, node := range layer {
+			node.x = layerWidth
+			node.y = height
+			layerWidth += node.width + svgHorizontalGap
+		}
+		if layerWidth > width {
+			width = layerWidth
+		}
+		height += svgNodeHeight + svgVerticalGap
+	}
+	width += svgMargin - svgHorizontalGap
+	if width < 3*(svgMinNodeWidth+svgHorizontalGap) {
+		width = 3 * (svgMinNodeWidth + svgHorizontalGap)
+	}
+	height += svgLegendHeight - svgVerticalGap + svgMargin
+	// Center each layer
+	for _, layer := range layers {
+		last := layer[len(layer)-1]
+		shift := (width - (last.x + last.width) - svgMargin) / 2
+		for _, node := range layer {
+			node.x += shift
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v" font-family="Helvetica, Arial, sans-serif">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(out, "<defs>%v%v</defs>\n", svgArrow("arrow", svgEdgeColor), svgArrow("cycle-arrow", svgCycleColor))
+	fmt.Fprintf(out, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	for _, edge := range d.Edges {
+		d.writeSVGEdge(out, edge, nodes[edge.From], nodes[edge.To])
+	}
+	for _, layer := range layers {
+		for _, node := range layer {
+			d.writeSVGNode(out, node)
+		}
+	}
+	writeSVGLegend(out, height-svgMargin-svgLegendHeight/2)
+	fmt.Fprintf(out, "</svg>\n")
+	return out.Flush()
+}
+
+// layout assigns components to layers, so that every edge not closing a cycle points to a lower layer.
+// Order within layers follows average position of dependent components, to reduce edge crossings.
+func (d *Diagram) layout() (map[string]*svgNode, [][]*svgNode) {
+	nodes := make(map[string]*svgNode)
+	index := make(map[string]int)
+	for i, component := range d.Components {
+		width := len(component.Name)*svgCharWidth + 20
+		if width < svgMinNodeWidth {
+			width = svgMinNodeWidth
+		}
+		nodes[component.GUID] = &svgNode{component: component, width: width}
+		index[component.GUID] = i
+	}
+
+	parents := make(map[string][]string)
+	for _, component := range d.Components {
+		for _, edge := range d.Edges {
+			from, to := nodes[edge.From], nodes[edge.To]
+			if edge.From != component.GUID || from == nil || to == nil || index[edge.To] <= index[edge.From] {
+				continue
+			}
+			if to.layer < from.layer+1 {
+				to.layer = from.layer + 1
+			}
+			parents[edge.To] = append(parents[edge.To], edge.From)
+		}
+	}
+
+	layers := [][]*svgNode{}
+	for _, component := range d.Components {
+		node := nodes[component.GUID]
+		for len(layers) <= node.layer {
+			layers = append(layers, []*svgNode{})
+		}
+		node.position = float64(len(layers[node.layer]))
+		layers[node.layer] = append(layers[node.layer], node)
+	}
+	for i := 1; i < len(layers); i++ {
+		for _, node := range layers[i] {
+			sum := 0.0
+			for _, parent := range parents[node.component.GUID] {
+				sum += nodes[parent].position
+			}
+			node.position = sum / float64(len(parents[node.component.GUID]))
+		}
+		sort.Stable(byPosition(layers[i]))
+		for position, node := range layers[i] {
+			node.position = float64(position)
+		}
+	}
+	return nodes, layers
+}
+
+func (d *Diagram) writeSVGNode(out io.Writer, node *svgNode) {
+	fill := svgColors[node.component.Type]
+	if len(fill) == 0 {
+		fill = "#bab0ac"
+	}
+	stroke, strokeWidth := "#333333", 1
+	if d.isInCycle(node.component.GUID) {
+		stroke, strokeWidth = svgCycleColor, 3
+	}
+	fmt.Fprintf(out, `<g><title>%v %v</title>`, svgEscape(string(node.component.Type)), svgEscape(node.component.GUID))
+	style := fmt.Sprintf(`fill="%v" stroke="%v" stroke-width="%v"`, fill, stroke, strokeWidth)
+	x, y, w, h := node.x, node.y, node.width, svgNodeHeight
+	switch node.component.Type {
+	case types.ComponentService:
+		fmt.Fprintf(out, `<rect x="%v" y="%v" width="%v" height="%v" rx="%v" ry="%v" %v/>`, x, y, w, h, h/2, h/2, style)
+	case types.ComponentUPS:
+		fmt.Fprintf(out, `<polygon points="%v,%v %v,%v %v,%v %v,%v %v,%v %v,%v" %v/>`,
+			x+10, y, x+w-10, y, x+w, y+h/2, x+w-10, y+h, x+10, y+h, x, y+h/2, style)
+	default:
+		fmt.Fprintf(out, `<rect x="%v" y="%v" width="%v" height="%v" %v/>`, x, y, w, h, style)
+	}
+	fmt.Fprintf(out, `<text x="%v" y="%v" text-anchor="middle" font-size="13" fill="white">%v</text></g>`+"\n",
+		node.centerX(), y+h/2+5, svgEscape(node.component.Name))
+}
+
+func (d *Diagram) writeSVGEdge(out io.Writer, edge Edge, from, to *svgNode) {
+	if from == nil || to == nil {
+		return
+	}
+	stroke, strokeWidth, marker := svgEdgeColor, 1, "arrow"
+	if d.isCycleEdge(edge) {
+		stroke, strokeWidth, marker = svgCycleColor, 2, "cycle-arrow"
+	}
+	dash := ""
+	if d.isDeferred(edge) {
+		dash = ` stroke-dasharray="6,4"`
+	}
+	var path string
+	var labelX, labelY int
+	if to.layer > from.layer {
+		x1, y1 := from.centerX(), from.y+svgNodeHeight
+		x2, y2 := to.centerX(), to.y
+		path = fmt.Sprintf("M %v %v L %v %v", x1, y1, x2, y2)
+		labelX, labelY = (x1+x2)/2, (y1+y2)/2
+	} else {
+		// Edge closing a cycle goes upwards, draw it as a curve on the right side
+		x1, y1 := from.x+from.width, from.y+svgNodeHeight/2
+		x2, y2 := to.x+to.width, to.y+svgNodeHeight/2
+		bend := svgHorizontalGap + 20*(from.layer-to.layer)
+		path = fmt.Sprintf("M %v %v C %v %v, %v %v, %v %v", x1, y1, x1+bend, y1, x2+bend, y2, x2, y2)
+		labelX, labelY = (x1+x2)/2+bend*3/4, (y1+y2)/2
+	}
+	fmt.Fprintf(out, `<path d="%v" fill="none" stroke="%v" stroke-width="%v"%v marker-end="url(#%v)"/>`,
+		path, stroke, strokeWidth, dash, marker)
+	fmt.Fprintf(out, `<text x="%v" y="%v" text-anchor="middle" font-size="10" fill="%v">%v</text>`+"\n",
+		labelX, labelY, stroke, svgEscape(d.edgeLabel(edge)))
+}
+
+func writeSVGLegend(out io.Writer, y int) {
+	x := svgMargin
+	for _, typ := range []types.ComponentType{types.ComponentApp, types.ComponentService, types.ComponentUPS} {
+		fmt.Fprintf(out, `<rect x="%v" y="%v" width="12" height="12" fill="%v"/>`, x, y-6, svgColors[typ])
+		fmt.Fprintf(out, `<text x="%v" y="%v" font-size="11">%v</text>`+"\n", x+16, y+4, svgEscape(string(typ)))
+		x += 16 + len(typ)*svgCharWidth + 20
+	}
+	fmt.Fprintf(out, `<line x1="%v" y1="%v" x2="%v" y2="%v" stroke="%v" stroke-width="2"/>`, x, y, x+20, y, svgCycleColor)
+	fmt.Fprintf(out, `<text x="%v" y="%v" font-size="11">cycle</text>`+"\n", x+24, y+4)
+}
+
+func svgArrow(id, color string) string {
+	return fmt.Sprintf(`<marker id="%v" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto">`+
+		`<path d="M 0 0 L 10 5 L 0 10 z" fill="%v"/></marker>`, id, color)
+}
+
+func svgEscape(s string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
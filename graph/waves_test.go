@@ -0,0 +1,62 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graph
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"reflect"
+	"testing"
+)
+
+func TestGroupIntoWaves(t *testing.T) {
+	tests := []struct {
+		name     string
+		stack    cftest.Stack
+		opts     Options
+		waves    [][]string
+		deferred []DeferredBinding
+	}{
+		{"diamond", cftest.DiamondStack(), Options{Waves: true}, [][]string{
+			{"db-guid", "shared-guid"},
+			{"shared-ups-guid"},
+			{"left-guid", "right-guid"},
+			{"left-ups-guid", "right-ups-guid"},
+			{"root-guid"},
+		}, []DeferredBinding{}},
+		{"deferred", cftest.CycleStack(), Options{Waves: true, Cycles: CyclesDefer}, [][]string{
+			{"backend-guid"},
+			{"backend-ups-guid"},
+			{"root-guid"},
+			{"root-ups-guid"},
+		}, []DeferredBinding{{AppGUID: "backend-guid", ServiceGUID: "root-ups-guid"}}},
+	}
+	for _, test := range tests {
+		fake := cftest.NewServer(test.stack)
+		discovery, err := NewGraphAPI(CfClient{CfAPI: fake.NewCfAPI()}).Discover("root-guid", test.opts)
+		fake.Close()
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(discovery.Waves, test.waves) {
+			t.Errorf("%v: expected waves %v, got %v", test.name, test.waves, discovery.Waves)
+		}
+		if !reflect.DeepEqual(discovery.DeferredBindings, test.deferred) {
+			t.Errorf("%v: expected deferred bindings %v, got %v", test.name, test.deferred, discovery.DeferredBindings)
+		}
+	}
+}
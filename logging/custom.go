@@ -18,19 +18,45 @@ package logging
 
 import (
 	log "github.com/cihub/seelog"
+	"io/ioutil"
 	"os"
+	"regexp"
 )
 
+var minLevelPattern = regexp.MustCompile(`minlevel="[a-z]*"`)
+
+const configFile = "logger.config"
+
 func Initialize() {
 	log.RegisterReceiver("stderr", &StdErrReceiver{})
 
-	logger, err := log.LoggerFromConfigAsFile("logger.config")
+	logger, err := log.LoggerFromConfigAsFile(configFile)
 	if err != nil {
 		println("Logger configuration failed! Err:" + err.Error())
 	}
 	log.ReplaceLogger(logger)
 }
 
+// SetLevel reconfigures logging to skip messages below given level, e.g. debug
+func SetLevel(level string) {
+	config, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		log.Errorf("Cannot read logger configuration: %v", err)
+		return
+	}
+	// Only the first minlevel belongs to the root element, the following ones are exceptions
+	if loc := minLevelPattern.FindIndex(config); loc != nil {
+		config = []byte(string(config[:loc[0]]) + `minlevel="` + level + `"` + string(config[loc[1]:]))
+	}
+	logger, err := log.LoggerFromConfigAsBytes(config)
+	if err != nil {
+		log.Errorf("Cannot set log level %v: %v", level, err)
+		return
+	}
+	log.ReplaceLogger(logger)
+	log.Infof("Log level set to %v", level)
+}
+
 type StdErrReceiver struct {
 }
 
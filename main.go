@@ -20,6 +20,19 @@
 //
 //     Version: 0.2.2
 //
+//     Produces:
+//     - application/json
+//
+//     SecurityDefinitions:
+//     basic:
+//       type: basic
+//       description: Credentials of API client
+//     bearer:
+//       type: apiKey
+//       in: header
+//       name: Authorization
+//       description: Access token issued by UAA, given as Bearer followed by the token
+//
 // swagger:meta
 package main
 
@@ -28,6 +41,7 @@ import (
 	"github.com/cloudfoundry-community/go-cfenv"
 	"github.com/trustedanalytics/app-dependency-discoverer/logging"
 	"github.com/trustedanalytics/app-dependency-discoverer/server"
+	"os"
 )
 
 func main() {
@@ -39,7 +53,12 @@ func main() {
 	}
 
 	config := server.Config{}
-	config.Initialize(cfEnv)
+	if err := config.Initialize(cfEnv); err != nil {
+		log.Critical(err)
+		log.Flush()
+		os.Exit(1)
+	}
+	logging.SetLevel(config.LogLevel)
 
 	server.Start(config)
 }
@@ -0,0 +1,109 @@
+//go:build ignore
+// +build ignore
+
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command embed-spec completes swagger.json and writes it into Spec constant of spec-json.go, so the document
+// is served and checked by the binary without reading it from disk
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Response bodies which go-swagger leaves without schema, as it ignores extensions of response fields,
+// with property of a definition whose x-any-of extension lists the same alternatives
+var openBodies = map[string][2]string{
+	"componentsListResponse": {"Job", "result"},
+}
+
+func main() {
+	spec, err := ioutil.ReadFile("swagger.json")
+	if err != nil {
+		fail(err)
+	}
+	if spec, err = completeBodies(spec); err != nil {
+		fail(err)
+	}
+	if err := ioutil.WriteFile("swagger.json", spec, 0644); err != nil {
+		fail(err)
+	}
+	// Backquotes cannot be part of raw string literal
+	literal := "`" + strings.Replace(string(spec), "`", "` + \"`\" + `", -1) + "`"
+
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "// Code generated by embed-spec.go from swagger.json; DO NOT EDIT.")
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "package openapi")
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "// Spec is Swagger 2.0 document of the API")
+	fmt.Fprintf(&out, "const Spec = %v\n", literal)
+	if err := ioutil.WriteFile("spec-json.go", out.Bytes(), 0644); err != nil {
+		fail(err)
+	}
+}
+
+// completeBodies replaces empty schema of every open response body with schema of its definition property.
+// The document is edited as text, so it stays formatted like go-swagger wrote it.
+func completeBodies(spec []byte) ([]byte, error) {
+	doc := struct {
+		Definitions map[string]struct {
+			Properties map[string]map[string]interface{}
+		}
+	}{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	text := string(spec)
+	for response, property := range openBodies {
+		schema, ok := doc.Definitions[property[0]].Properties[property[1]]
+		if !ok || schema["x-any-of"] == nil {
+			return nil, fmt.Errorf("%v.%v has no x-any-of extension", property[0], property[1])
+		}
+		delete(schema, "description")
+		delete(schema, "x-go-name")
+		formatted, err := json.MarshalIndent(schema, "      ", "  ")
+		if err != nil {
+			return nil, err
+		}
+		start := strings.Index(text, "\n    \""+response+"\": {")
+		if start < 0 {
+			return nil, fmt.Errorf("response %v not found", response)
+		}
+		end := start + 1 + strings.Index(text[start+1:], "\n    }")
+		body := strings.Index(text[start:end], `"schema": {}`)
+		if body < 0 && strings.Contains(text[start:end], `"x-any-of"`) {
+			continue
+		}
+		if body < 0 {
+			return nil, fmt.Errorf("response %v has no open body", response)
+		}
+		body += start + len(`"schema": `)
+		text = text[:body] + string(formatted) + text[body+len("{}"):]
+	}
+	return []byte(text), nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
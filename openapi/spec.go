@@ -0,0 +1,23 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package openapi holds Swagger document of the discoverer and checks responses against it
+package openapi
+
+// The document is generated from swagger annotations of the code into swagger.json with go-swagger,
+// then copied into Spec constant in spec-json.go. Run go generate after changing the annotations.
+//go:generate swagger generate spec --work-dir .. --scan-models --output swagger.json
+//go:generate go run embed-spec.go
@@ -0,0 +1,96 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// maxCheckedBody limits size of response bodies kept for checking
+const maxCheckedBody = 16 << 20
+
+// Violation is a response not matching the document
+type Violation struct {
+	Method   string
+	Path     string
+	Status   int
+	Problems []string
+}
+
+// Validating returns handler checking every response of given handler against the document.
+// Responses are passed to clients unchanged and each one not matching the document is reported.
+// Responses to undocumented paths are reported too, unless they are 404 Not Found.
+func (d *Document) Validating(handler http.Handler, report func(Violation)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &bodyRecorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		// Body too large to keep is not checked
+		var body []byte
+		if !recorder.truncated {
+			body = append([]byte{}, recorder.body.Bytes()...)
+		}
+		problems, err := d.CheckResponse(r.Method, r.URL.Path, recorder.status, w.Header().Get("Content-Type"), body)
+		if err == ErrUndocumented {
+			if recorder.status == http.StatusNotFound {
+				return
+			}
+			problems = []string{err.Error()}
+		}
+		if len(problems) > 0 {
+			report(Violation{Method: r.Method, Path: r.URL.Path, Status: recorder.status, Problems: problems})
+		}
+	})
+}
+
+// bodyRecorder remembers status code and copy of the body of the response
+type bodyRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *bodyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.body.Len()+len(b) > maxCheckedBody {
+		r.truncated = true
+		r.body.Reset()
+	} else if !r.truncated {
+		r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *bodyRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
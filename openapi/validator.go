@@ -0,0 +1,378 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is a parsed Swagger 2.0 document, able to check responses against it.
+// Only parts of JSON Schema used by the discoverer are supported: $ref, allOf, type, enum, properties, required,
+// additionalProperties and items, with x-nullable and x-any-of extensions. The latter lists alternative schemas,
+// which Swagger 2.0 cannot express otherwise. Objects with properties are closed: properties not documented
+// are reported, unless additionalProperties allows them.
+type Document struct {
+	raw  []byte
+	root map[string]interface{}
+}
+
+// Parse reads Swagger document from JSON
+func Parse(spec string) (*Document, error) {
+	toReturn := new(Document)
+	toReturn.raw = []byte(spec)
+	if err := json.Unmarshal([]byte(spec), &toReturn.root); err != nil {
+		return nil, fmt.Errorf("Cannot parse Swagger document: %v", err)
+	}
+	return toReturn, nil
+}
+
+// MustParse is like Parse, but panics if the document is not valid JSON
+func MustParse(spec string) *Document {
+	doc, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// ErrUndocumented is returned by CheckResponse for paths not described by the document
+var ErrUndocumented = errors.New("Path is not documented")
+
+// CheckResponse returns problems found in response to request with given method and path.
+// Content type has to be one the operation produces. Body is checked against the schema if it is JSON and not nil.
+// ErrUndocumented is returned if the path is unknown.
+func (d *Document) CheckResponse(method, path string, status int, contentType string, body []byte) ([]string, error) {
+	item := d.pathItem(path)
+	if item == nil {
+		return nil, ErrUndocumented
+	}
+	operation, ok := item[strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("%v %v is not documented", method, path)}, nil
+	}
+	responses, _ := operation["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(status)].(map[string]interface{})
+	if !ok {
+		if response, ok = responses["default"].(map[string]interface{}); !ok {
+			return []string{fmt.Sprintf("Status %v is not documented", status)}, nil
+		}
+	}
+	response = d.resolve(response)
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return []string{fmt.Sprintf("Invalid Content-Type [%v]", contentType)}, nil
+	}
+	produces := d.produces(operation)
+	if !contains(produces, mediaType) {
+		return []string{fmt.Sprintf("Content-Type %v is not documented, expected one of %v",
+			mediaType, strings.Join(produces, ", "))}, nil
+	}
+	schema, ok := response["schema"].(map[string]interface{})
+	if !ok {
+		if mediaType == "application/json" {
+			return []string{"Response has body, but none is documented"}, nil
+		}
+		return nil, nil
+	}
+	if mediaType != "application/json" {
+		return nil, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []string{fmt.Sprintf("Body is not valid JSON: %v", err)}, nil
+	}
+	return d.check(schema, value, "$"), nil
+}
+
+// produces returns media types of the operation, falling back to those of the whole API
+func (d *Document) produces(operation map[string]interface{}) []string {
+	list, ok := operation["produces"].([]interface{})
+	if !ok {
+		list, ok = d.root["produces"].([]interface{})
+	}
+	if !ok {
+		return []string{"application/json"}
+	}
+	toReturn := []string{}
+	for _, mediaType := range list {
+		if s, ok := mediaType.(string); ok {
+			toReturn = append(toReturn, s)
+		}
+	}
+	return toReturn
+}
+
+// pathItem returns description of the path, matching templated segments like {rootGUID} with any value
+func (d *Document) pathItem(path string) map[string]interface{} {
+	paths, _ := d.root["paths"].(map[string]interface{})
+	if item, ok := paths[path].(map[string]interface{}); ok {
+		return item
+	}
+	segments := strings.Split(path, "/")
+	for template, item := range paths {
+		templateSegments := strings.Split(template, "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+		matches := true
+		for i, segment := range templateSegments {
+			isParam := strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+			if (isParam && len(segments[i]) == 0) || (!isParam && segment != segments[i]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			toReturn, _ := item.(map[string]interface{})
+			return toReturn
+		}
+	}
+	return nil
+}
+
+// resolve follows $ref of the object, if it has one
+func (d *Document) resolve(object map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 10; i++ {
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return object
+		}
+		var current interface{} = d.root
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			parent, _ := current.(map[string]interface{})
+			current = parent[part]
+		}
+		resolved, ok := current.(map[string]interface{})
+		if !ok {
+			return map[string]interface{}{}
+		}
+		object = resolved
+	}
+	return object
+}
+
+// objectSchema merges properties, required properties and additional properties of the schema
+// with those of all schemas it is composed of with allOf
+type objectSchema struct {
+	properties map[string]map[string]interface{}
+	required   map[string]bool
+	// Nil if additional properties are not described
+	additional interface{}
+}
+
+func (d *Document) merge(schema map[string]interface{}, into *objectSchema) {
+	schema = d.resolve(schema)
+	properties, _ := schema["properties"].(map[string]interface{})
+	for name, property := range properties {
+		if p, ok := property.(map[string]interface{}); ok {
+			into.properties[name] = p
+		}
+	}
+	required, _ := schema["required"].([]interface{})
+	for _, name := range required {
+		if s, ok := name.(string); ok {
+			into.required[s] = true
+		}
+	}
+	if additional, ok := schema["additionalProperties"]; ok {
+		into.additional = additional
+	}
+	parts, _ := schema["allOf"].([]interface{})
+	for _, part := range parts {
+		if p, ok := part.(map[string]interface{}); ok {
+			d.merge(p, into)
+		}
+	}
+}
+
+// check returns problems of the value, described by JSON path
+func (d *Document) check(schema map[string]interface{}, value interface{}, at string) []string {
+	schema = d.resolve(schema)
+	if value == nil {
+		if nullable, _ := schema["x-nullable"].(bool); nullable || len(schema) == 0 {
+			return nil
+		}
+		return []string{fmt.Sprintf("%v is null", at)}
+	}
+
+	if alternatives, ok := schema["x-any-of"].([]interface{}); ok {
+		// If no alternative matches, problems of the one of the same type as the value are returned
+		var closest []string
+		for _, alternative := range alternatives {
+			s, _ := alternative.(map[string]interface{})
+			problems := d.check(s, value, at)
+			if len(problems) == 0 {
+				return nil
+			}
+			if typ, ok := d.resolve(s)["type"].(string); closest == nil || (ok && hasType(value, typ)) {
+				closest = problems
+			}
+		}
+		return closest
+	}
+
+	problems := []string{}
+	parts, _ := schema["allOf"].([]interface{})
+	for _, part := range parts {
+		if p, ok := part.(map[string]interface{}); ok {
+			problems = append(problems, d.checkValue(d.resolve(p), value, at)...)
+		}
+	}
+	problems = append(problems, d.checkValue(schema, value, at)...)
+	if object, ok := value.(map[string]interface{}); ok {
+		problems = append(problems, d.checkObject(schema, object, at)...)
+	}
+	return problems
+}
+
+// checkValue returns problems of the value against type, enum and items of the schema, but not its properties
+func (d *Document) checkValue(schema map[string]interface{}, value interface{}, at string) []string {
+	if typ, ok := schema["type"].(string); ok && !hasType(value, typ) {
+		return []string{fmt.Sprintf("%v should be %v, got %v", at, typ, typeOf(value))}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []string{fmt.Sprintf("%v should be one of %v, got %v", at, enum, value)}
+		}
+	}
+	problems := []string{}
+	if array, ok := value.([]interface{}); ok {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range array {
+				problems = append(problems, d.check(items, item, fmt.Sprintf("%v[%v]", at, i))...)
+			}
+		}
+	}
+	return problems
+}
+
+// checkObject returns problems of properties of the object, described by the schema and all schemas
+// it is composed of. Null is accepted for properties which are not required.
+func (d *Document) checkObject(schema map[string]interface{}, object map[string]interface{}, at string) []string {
+	described := &objectSchema{properties: map[string]map[string]interface{}{}, required: map[string]bool{}}
+	d.merge(schema, described)
+	problems := []string{}
+	for _, name := range sortedKeys(described.required) {
+		if _, ok := object[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%v.%v is required", at, name))
+		}
+	}
+	for _, name := range keys(object) {
+		value := object[name]
+		if property, ok := described.properties[name]; ok {
+			if value != nil || described.required[name] {
+				problems = append(problems, d.check(property, value, at+"."+name)...)
+			}
+			continue
+		}
+		switch additional := described.additional.(type) {
+		case bool:
+			if !additional {
+				problems = append(problems, fmt.Sprintf("%v.%v is not documented", at, name))
+			}
+		case map[string]interface{}:
+			problems = append(problems, d.check(additional, value, at+"."+name)...)
+		case nil:
+			if len(described.properties) > 0 {
+				problems = append(problems, fmt.Sprintf("%v.%v is not documented", at, name))
+			}
+		}
+	}
+	return problems
+}
+
+func hasType(value interface{}, typ string) bool {
+	switch typ {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return typeOf(value) == typ
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func keys(object map[string]interface{}) []string {
+	toReturn := make([]string, 0, len(object))
+	for key := range object {
+		toReturn = append(toReturn, key)
+	}
+	sort.Strings(toReturn)
+	return toReturn
+}
+
+func sortedKeys(set map[string]bool) []string {
+	toReturn := make([]string, 0, len(set))
+	for key := range set {
+		toReturn = append(toReturn, key)
+	}
+	sort.Strings(toReturn)
+	return toReturn
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP responds with the document, as it was parsed
+func (d *Document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(d.raw)
+}
@@ -0,0 +1,47 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"testing"
+)
+
+func TestCheckDiscoveryBody(t *testing.T) {
+	doc := MustParse(Spec)
+	tests := []struct {
+		name   string
+		body   string
+		errors bool
+	}{
+		{"components", `[{"GUID": "root-guid", "name": "root", "type": "APPLICATION", "dependencyOf": []}]`, false},
+		{"plan", `{"components": [], "deferredBindings": [], "warnings": [], "waves": [["root-guid"]]}`, false},
+		{"detailed plan", `{"components": [], "edges": [], "deferredBindings": [], "warnings": []}`, false},
+		{"object", `{"status": 200}`, true},
+		{"plan without warnings", `{"components": [], "deferredBindings": []}`, true},
+		{"component of wrong shape", `[{"GUID": 7}]`, true},
+		{"string", `"root-guid"`, true},
+	}
+	for _, test := range tests {
+		problems, err := doc.CheckResponse("GET", "/v1/discover/root-guid", 200, "application/json", []byte(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(problems) > 0) != test.errors {
+			t.Errorf("%v: expected problems %v, got %v", test.name, test.errors, problems)
+		}
+	}
+}
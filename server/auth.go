@@ -0,0 +1,119 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	log "github.com/cihub/seelog"
+	"github.com/go-martini/martini"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const authRealm = "app-dependency-discoverer"
+
+// Caller is the authenticated consumer of the API, mapped into request context
+type Caller struct {
+	// User or client name
+	Name string
+	// Bearer token the caller authenticated with, empty for basic authentication
+	Token string
+	// ID of the user the token was issued to, empty for client tokens and basic authentication
+	UserID string
+}
+
+// identity distinguishes callers, so that users, clients with tokens and basic authentication consumers
+// of the same name are not mistaken for each other
+func (c *Caller) identity() string {
+	if len(c.UserID) > 0 {
+		return "user:" + c.UserID
+	}
+	if len(c.Token) > 0 {
+		return "client:" + c.Name
+	}
+	return "basic:" + c.Name
+}
+
+// metricLabel names the caller in metrics: API clients and clients with tokens by their name,
+// users all together, so that number of label values is bounded by number of clients
+func (c *Caller) metricLabel() string {
+	if len(c.UserID) > 0 {
+		return "user"
+	}
+	return c.Name
+}
+
+// newAuthenticator returns handler accepting UAA bearer tokens with required scope,
+// or basic authentication credentials of API clients. Requests of every caller are limited by the limiter.
+func newAuthenticator(verifier *tokenVerifier, clients *clientRegistry, limiter *rateLimiter) martini.Handler {
+	return func(w http.ResponseWriter, r *http.Request, c martini.Context) {
+		var caller *Caller
+		var client APIClient
+		header := r.Header.Get("Authorization")
+		if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+			token := strings.TrimSpace(header[7:])
+			claims, err := verifier.verify(token)
+			if err == errInsufficientScope {
+				log.Warnf("Rejected token of %v without scope %v", claims.name(), verifier.scope)
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v", error="insufficient_scope", scope="%v"`,
+					authRealm, verifier.scope))
+				respondWithError(&w, http.StatusForbidden, err.Error())
+				return
+			}
+			if err != nil {
+				log.Warnf("Rejected token: %v", err)
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v", error="invalid_token"`, authRealm))
+				respondWithError(&w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			caller = &Caller{Name: claims.name(), Token: token, UserID: claims.UserID}
+		} else {
+			name, secret, ok := r.BasicAuth()
+			if ok {
+				client, ok = clients.authenticate(name, secret)
+			}
+			if !ok {
+				if len(name) > 0 {
+					log.Warnf("Rejected credentials of %v", name)
+				}
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v"`, authRealm))
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%v"`, authRealm))
+				respondWithError(&w, http.StatusUnauthorized, "Not Authorized")
+				return
+			}
+			caller = &Caller{Name: client.Name}
+		}
+
+		if allowed, wait := limiter.allow(caller.identity(), client.RateLimit, client.Burst, time.Now()); !allowed {
+			log.Warnf("%v exceeded its rate limit, rejected %v %v", caller.Name, r.Method, r.URL.Path)
+			rateLimited.Inc(caller.metricLabel())
+			clientRequests.Inc(caller.metricLabel(), strconv.Itoa(http.StatusTooManyRequests))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondWithError(&w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+		log.Infof("%v %v requested by %v", r.Method, r.URL.Path, caller.Name)
+		c.Map(caller)
+		c.Next()
+		if rw, ok := w.(martini.ResponseWriter); ok {
+			clientRequests.Inc(caller.metricLabel(), strconv.Itoa(rw.Status()))
+		}
+	}
+}
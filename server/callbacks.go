@@ -0,0 +1,123 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	log "github.com/cihub/seelog"
+	"net/http"
+	"time"
+)
+
+const (
+	// SignatureHeader carries hex encoded HMAC-SHA256 of callback body, keyed with shared secret
+	SignatureHeader = "X-Discoverer-Signature"
+	// JobHeader carries ID of the job callback is sent for
+	JobHeader = "X-Discoverer-Job"
+)
+
+// Delivery states of callback
+const (
+	CallbackPending   = "pending"
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"
+)
+
+// CallbackStatus tells whether status of finished job was delivered to callback URL
+type CallbackStatus struct {
+	URL      string `json:"url"`
+	State    string `json:"state"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// callbackSender posts signed payloads, retrying with exponential backoff
+type callbackSender struct {
+	secret   []byte
+	client   *http.Client
+	attempts int
+	delay    time.Duration
+}
+
+func newCallbackSender(secret string, attempts int, delay, timeout time.Duration) *callbackSender {
+	if attempts < 1 {
+		attempts = 1
+	}
+	toReturn := new(callbackSender)
+	toReturn.secret = []byte(secret)
+	toReturn.client = &http.Client{Timeout: timeout}
+	toReturn.attempts = attempts
+	toReturn.delay = delay
+	return toReturn
+}
+
+// sign returns value of signature header for given body
+func (s *callbackSender) sign(body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver posts body to the url until it is accepted or attempts run out, reporting result of every attempt.
+// Delay between attempts doubles each time. Requests rejected with client error other than 408 or 429 are not retried.
+func (s *callbackSender) deliver(url, jobID string, body []byte, report func(attempt int, err error)) error {
+	delay := s.delay
+	var err error
+	for attempt := 1; attempt <= s.attempts; attempt++ {
+		var retry bool
+		retry, err = s.post(url, jobID, body)
+		report(attempt, err)
+		if err == nil {
+			log.Infof("Status of job %v delivered to %v", jobID, url)
+			return nil
+		}
+		log.Warnf("Attempt %v of delivering status of job %v to %v failed: %v", attempt, jobID, url, err)
+		if !retry || attempt == s.attempts {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	log.Errorf("Giving up delivering status of job %v to %v", jobID, url)
+	return err
+}
+
+// post sends body once, telling whether failure is worth retrying
+func (s *callbackSender) post(url, jobID string, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(JobHeader, jobID)
+	req.Header.Set(SignatureHeader, s.sign(body))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("Callback responded with %v", resp.Status)
+}
@@ -0,0 +1,105 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignCallback(t *testing.T) {
+	sender := newCallbackSender("key", 1, 0, time.Second)
+	// Known HMAC-SHA256 test vector
+	signature := sender.sign([]byte("The quick brown fox jumps over the lazy dog"))
+	if expected := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"; signature != expected {
+		t.Errorf("expected signature %v, got %v", expected, signature)
+	}
+	other := newCallbackSender("other key", 1, 0, time.Second)
+	if other.sign([]byte("The quick brown fox jumps over the lazy dog")) == signature {
+		t.Error("signature should depend on the secret")
+	}
+}
+
+// callbackReceiver responds with given statuses in turn, repeating the last one, and records requests
+type callbackReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (c *callbackReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.statuses[len(c.statuses)-1]
+	if len(c.requests) < len(c.statuses) {
+		status = c.statuses[len(c.requests)]
+	}
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, string(body))
+	w.WriteHeader(status)
+}
+
+func TestDeliverCallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		attempts  []bool
+		delivered bool
+	}{
+		{"accepted", []int{http.StatusNoContent}, []bool{true}, true},
+		{"server error retried", []int{http.StatusBadGateway, http.StatusInternalServerError, http.StatusOK},
+			[]bool{false, false, true}, true},
+		{"timeout retried", []int{http.StatusRequestTimeout, http.StatusOK}, []bool{false, true}, true},
+		{"rate limit retried", []int{http.StatusTooManyRequests, http.StatusOK}, []bool{false, true}, true},
+		{"client error not retried", []int{http.StatusBadRequest, http.StatusOK}, []bool{false}, false},
+		{"missing endpoint not retried", []int{http.StatusNotFound}, []bool{false}, false},
+		{"attempts run out", []int{http.StatusServiceUnavailable}, []bool{false, false, false, false}, false},
+	}
+	for _, test := range tests {
+		receiver := &callbackReceiver{statuses: test.statuses}
+		server := httptest.NewServer(receiver)
+		sender := newCallbackSender("secret", 4, time.Millisecond, time.Second)
+
+		attempts := []bool{}
+		err := sender.deliver(server.URL, "job-id", []byte(`{"id":"job-id"}`), func(attempt int, err error) {
+			if attempt != len(attempts)+1 {
+				t.Errorf("%v: attempt %v reported after %v", test.name, attempt, len(attempts))
+			}
+			attempts = append(attempts, err == nil)
+		})
+		server.Close()
+
+		if (err == nil) != test.delivered {
+			t.Errorf("%v: expected delivered %v, got error %v", test.name, test.delivered, err)
+		}
+		if !reflect.DeepEqual(attempts, test.attempts) {
+			t.Errorf("%v: expected attempts %v, got %v", test.name, test.attempts, attempts)
+		}
+		for i, req := range receiver.requests {
+			if req.Header.Get(JobHeader) != "job-id" || req.Header.Get(SignatureHeader) != sender.sign([]byte(receiver.bodies[i])) {
+				t.Errorf("%v: request %v is not signed for the job: %v", test.name, i, req.Header)
+			}
+		}
+	}
+}
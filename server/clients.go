@@ -0,0 +1,140 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/martini-contrib/auth"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// APIClient is a named consumer of the API, authenticating with basic authentication
+type APIClient struct {
+	Name string `json:"name" yaml:"name"`
+	// bcrypt hash of the secret of the client
+	SecretHash string `json:"secretHash" yaml:"secretHash"`
+	// Requests per minute allowed to the client and how many of them may come at once.
+	// Limits set in configuration apply if zero.
+	RateLimit int `json:"rateLimit" yaml:"rateLimit"`
+	Burst     int `json:"burst" yaml:"burst"`
+}
+
+// apiClients reads API clients from JSON given in setting named key, or from JSON or YAML file named by fileKey
+func (s *settings) apiClients(key, fileKey string) []APIClient {
+	clients := []APIClient{}
+	if value, ok := s.values[key]; ok {
+		if err := json.Unmarshal([]byte(value), &clients); err != nil {
+			s.problem("%v must be JSON list of clients: %v", key, err)
+			return nil
+		}
+	} else if path, ok := s.values[fileKey]; ok {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			s.problem("Cannot read %v: %v", fileKey, err)
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			err = json.Unmarshal(content, &clients)
+		case ".yml", ".yaml":
+			err = yaml.Unmarshal(content, &clients)
+		default:
+			err = fmt.Errorf("unknown format, use .json, .yml or .yaml")
+		}
+		if err != nil {
+			s.problem("Cannot parse %v %v: %v", fileKey, path, err)
+			return nil
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, client := range clients {
+		if len(client.Name) == 0 {
+			s.problem("API client #%v has no name", i+1)
+			continue
+		}
+		if names[client.Name] {
+			s.problem("API client %v is defined more than once", client.Name)
+		}
+		names[client.Name] = true
+		if _, err := bcrypt.Cost([]byte(client.SecretHash)); err != nil {
+			s.problem("API client %v must have bcrypt hash of its secret: %v", client.Name, err)
+		}
+		if client.RateLimit < 0 || client.Burst < 0 {
+			s.problem("API client %v must have non-negative rate limit and burst", client.Name)
+		}
+	}
+	return clients
+}
+
+// clientRegistry authenticates API clients, and the legacy consumer with plain text password
+type clientRegistry struct {
+	clients        map[string]APIClient
+	legacyUser     string
+	legacyPassword string
+	// SHA-256 of secrets which were recently verified, by client name. Checking bcrypt hash on every request
+	// would be too slow, as it is meant to be.
+	mu       sync.Mutex
+	verified map[string][sha256.Size]byte
+}
+
+func newClientRegistry(config Config) *clientRegistry {
+	toReturn := new(clientRegistry)
+	toReturn.clients = make(map[string]APIClient)
+	for _, client := range config.APIClients {
+		toReturn.clients[client.Name] = client
+	}
+	toReturn.legacyUser = config.AuthUser
+	toReturn.legacyPassword = config.AuthPassword
+	toReturn.verified = make(map[string][sha256.Size]byte)
+	return toReturn
+}
+
+// authenticate returns the client with given name if the secret is correct
+func (r *clientRegistry) authenticate(name, secret string) (APIClient, bool) {
+	client, ok := r.clients[name]
+	if !ok {
+		if len(r.legacyUser) > 0 && auth.SecureCompare(name, r.legacyUser) &&
+			auth.SecureCompare(secret, r.legacyPassword) {
+			return APIClient{Name: r.legacyUser}, true
+		}
+		return APIClient{}, false
+	}
+
+	digest := sha256.Sum256([]byte(secret))
+	r.mu.Lock()
+	verified, ok := r.verified[name]
+	r.mu.Unlock()
+	if ok && subtle.ConstantTimeCompare(verified[:], digest[:]) == 1 {
+		return client, true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)) != nil {
+		return APIClient{}, false
+	}
+	r.mu.Lock()
+	r.verified[name] = digest
+	r.mu.Unlock()
+	return client, true
+}
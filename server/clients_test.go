@@ -0,0 +1,85 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func newTestRegistry(t *testing.T, secret string) *clientRegistry {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newClientRegistry(Config{
+		APIClients:   []APIClient{{Name: "ci", SecretHash: string(hash), RateLimit: 120}},
+		AuthUser:     "admin",
+		AuthPassword: "password",
+	})
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	registry := newTestRegistry(t, "secret")
+	tests := []struct {
+		name, secret string
+		ok           bool
+	}{
+		{"ci", "secret", true},
+		{"ci", "wrong", false},
+		{"ci", "", false},
+		{"admin", "password", true},
+		{"admin", "secret", false},
+		{"unknown", "secret", false},
+	}
+	for _, test := range tests {
+		client, ok := registry.authenticate(test.name, test.secret)
+		if ok != test.ok {
+			t.Errorf("%v with secret [%v]: expected %v, got %v", test.name, test.secret, test.ok, ok)
+		}
+		if ok && client.Name != test.name {
+			t.Errorf("%v: authenticated as %v", test.name, client.Name)
+		}
+	}
+	if client, _ := registry.authenticate("ci", "secret"); client.RateLimit != 120 {
+		t.Errorf("expected limits of the client, got %+v", client)
+	}
+}
+
+func TestAuthenticateCachesVerifiedSecret(t *testing.T) {
+	registry := newTestRegistry(t, "secret")
+	if _, ok := registry.authenticate("ci", "wrong"); ok {
+		t.Fatal("wrong secret should be rejected")
+	}
+	if len(registry.verified) != 0 {
+		t.Fatal("rejected secret should not be cached")
+	}
+	if _, ok := registry.authenticate("ci", "secret"); !ok {
+		t.Fatal("correct secret should be accepted")
+	}
+
+	// Once verified, the secret is accepted without checking bcrypt hash
+	client := registry.clients["ci"]
+	client.SecretHash = "not a bcrypt hash"
+	registry.clients["ci"] = client
+	if _, ok := registry.authenticate("ci", "secret"); !ok {
+		t.Error("verified secret should be accepted from cache")
+	}
+	if _, ok := registry.authenticate("ci", "wrong"); ok {
+		t.Error("other secret should not be accepted from cache")
+	}
+}
@@ -17,25 +17,419 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
 	log "github.com/cihub/seelog"
 	"github.com/cloudfoundry-community/go-cfenv"
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"github.com/trustedanalytics/go-cf-lib/api"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Log levels accepted by LOG_LEVEL setting
+var logLevels = []string{"trace", "debug", "info", "warn", "error", "critical", "off"}
+
 // Config hold the broker configuration
 type Config struct {
 	CFEnv *cfenv.App
+
+	// Basic authentication credentials of the legacy API consumer, with plain text password
+	AuthUser     string
+	AuthPassword string
+	// Named API consumers, authenticating with basic authentication
+	APIClients []APIClient
+	// Whether only UAA bearer tokens are accepted, with no basic authentication consumer configured
+	BearerOnly bool
+	// Requests per minute allowed to each caller and how many of them may come at once, unless set for the client
+	RateLimit      int
+	RateLimitBurst int
+
+	// Cloud Controller address and client credentials of the discoverer in UAA
+	CFAPI        string
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+
+	// UAA address, publishing keys which bearer tokens are verified with
+	UAAURL string
+	// Bearer tokens have to be intended for the audience and have the scope. Issuer is checked if set.
+	JWTAudience string
+	JWTScope    string
+	JWTIssuer   string
+	// How long token keys are cached
+	TokenKeysTTL time.Duration
+
+	// Limit of concurrent Cloud Controller lookups in a single discovery
+	Parallelism int
+	// Glob patterns of credential keys of user provided services which are scanned for urls of applications,
+	// all if empty, and which are never scanned
+	CredentialKeysAllow []string
+	CredentialKeysDeny  []string
+	// Number of asynchronous discovery jobs run at once
+	JobWorkers int
+	// Number of asynchronous discovery jobs waiting for a worker, before new ones are rejected
+	JobQueueSize int
+	// How long results of finished asynchronous discovery jobs are kept
+	JobResultTTL time.Duration
+	// Shared secret signing job status posted to callback URLs. Callbacks are refused if empty.
+	CallbackSecret string
+	// Number of attempts to deliver job status to callback URL
+	CallbackAttempts int
+	// Delay before the second delivery attempt, doubled before each next one
+	CallbackRetryDelay time.Duration
+	// How long result of checking UAA and Cloud Controller reachability is reused by readiness endpoint
+	ReadinessCacheTTL time.Duration
+
+	// Timeouts of a single request to Cloud Controller or UAA, to callback URL and of a readiness check
+	CCTimeout        time.Duration
+	CallbackTimeout  time.Duration
+	ReadinessTimeout time.Duration
+
+	// Connection settings of Cloud Controller and UAA client
+	CCDialTimeout         time.Duration
+	CCTLSHandshakeTimeout time.Duration
+	CCIdleConnTimeout     time.Duration
+	CCMaxIdleConnsPerHost int
+
+	// Minimal level of logged messages
+	LogLevel string
+	// Whether every response is checked against OpenAPI document of the API
+	ContractValidation bool
+}
+
+// ConfigError lists every missing or invalid setting
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "Invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
 }
 
-// Initialize config with values from environment variables
-func (c *Config) Initialize(cfEnv *cfenv.App) {
+// Initialize config with values from environment variables, falling back to config file named by CONFIG_FILE.
+// All settings are validated, and ConfigError listing every problem is returned if any is missing or invalid.
+func (c *Config) Initialize(cfEnv *cfenv.App) error {
 	log.Debug("initializing app dependency discoverer config...")
 
+	s := &settings{values: make(map[string]string)}
+	if path := os.Getenv("CONFIG_FILE"); len(path) > 0 {
+		if err := s.loadFile(path); err != nil {
+			return &ConfigError{Problems: []string{err.Error()}}
+		}
+	}
+	s.loadEnv()
+
 	if cfEnv == nil {
 		cfEnv = &cfenv.App{}
-		cfEnv.Port = GetEnvVarAsInt("PORT", 9998)
+		cfEnv.Port = s.positiveInt("PORT", 9998)
 		cfEnv.Host = "0.0.0.0"
 		cfEnv.TempDir = os.TempDir()
 	}
 	c.CFEnv = cfEnv
+
+	c.AuthUser = s.optional("AUTH_USER", "")
+	c.AuthPassword = s.optional("AUTH_PASS", "")
+	if (len(c.AuthUser) > 0) != (len(c.AuthPassword) > 0) {
+		s.problem("AUTH_USER and AUTH_PASS must be given together")
+	}
+	c.APIClients = s.apiClients("API_CLIENTS", "API_CLIENTS_FILE")
+	for _, client := range c.APIClients {
+		if len(c.AuthUser) > 0 && client.Name == c.AuthUser {
+			s.problem("API client %v is defined by AUTH_USER as well", client.Name)
+		}
+	}
+	c.BearerOnly = s.boolean("AUTH_BEARER_ONLY", false)
+	hasBasicAuth := len(c.AuthUser) > 0 || len(c.APIClients) > 0
+	if !hasBasicAuth && !c.BearerOnly {
+		s.problem("AUTH_USER and AUTH_PASS, API_CLIENTS or API_CLIENTS_FILE is required, unless AUTH_BEARER_ONLY is true")
+	}
+	if hasBasicAuth && c.BearerOnly {
+		s.problem("AUTH_BEARER_ONLY cannot be true with AUTH_USER, API_CLIENTS or API_CLIENTS_FILE set")
+	}
+	c.RateLimit = s.positiveInt("RATE_LIMIT", 600)
+	c.RateLimitBurst = s.positiveInt("RATE_LIMIT_BURST", 60)
+
+	c.CFAPI = s.url("CF_API")
+	c.TokenURL = s.url("TOKEN_URL")
+	c.ClientID = s.required("CLIENT_ID")
+	c.ClientSecret = s.required("CLIENT_SECRET")
+
+	c.UAAURL = s.optionalURL("UAA_URL", strings.TrimSuffix(c.TokenURL, "/oauth/token"))
+	c.JWTAudience = s.optional("AUTH_JWT_AUDIENCE", "app_dependency_discoverer")
+	c.JWTScope = s.optional("AUTH_JWT_SCOPE", "app_dependency_discoverer.read")
+	c.JWTIssuer = s.optional("AUTH_JWT_ISSUER", "")
+	c.TokenKeysTTL = s.duration("TOKEN_KEYS_TTL", 10*time.Minute)
+
+	c.Parallelism = s.positiveInt("DISCOVERY_PARALLELISM", graph.DefaultParallelism)
+	c.CredentialKeysAllow = s.patterns("CREDENTIAL_KEYS_ALLOW")
+	c.CredentialKeysDeny = s.patterns("CREDENTIAL_KEYS_DENY")
+	c.JobWorkers = s.positiveInt("DISCOVERY_JOB_WORKERS", 2)
+	c.JobQueueSize = s.positiveInt("DISCOVERY_JOB_QUEUE_SIZE", 20)
+	c.JobResultTTL = s.duration("DISCOVERY_JOB_RESULT_TTL", 10*time.Minute)
+	c.CallbackSecret = s.optional("CALLBACK_SECRET", "")
+	c.CallbackAttempts = s.positiveInt("CALLBACK_ATTEMPTS", 5)
+	c.CallbackRetryDelay = s.duration("CALLBACK_RETRY_DELAY", time.Second)
+	c.ReadinessCacheTTL = s.duration("READINESS_CACHE_TTL", 30*time.Second)
+
+	c.CCTimeout = s.duration("CC_TIMEOUT", 30*time.Second)
+	c.CallbackTimeout = s.duration("CALLBACK_TIMEOUT", 30*time.Second)
+	c.ReadinessTimeout = s.duration("READINESS_TIMEOUT", 5*time.Second)
+
+	c.CCDialTimeout = s.duration("CC_DIAL_TIMEOUT", 10*time.Second)
+	c.CCTLSHandshakeTimeout = s.duration("CC_TLS_HANDSHAKE_TIMEOUT", 10*time.Second)
+	c.CCIdleConnTimeout = s.duration("CC_IDLE_CONN_TIMEOUT", 90*time.Second)
+	c.CCMaxIdleConnsPerHost = s.positiveInt("CC_MAX_IDLE_CONNS_PER_HOST", 16)
+
+	c.LogLevel = s.oneOf("LOG_LEVEL", "info", logLevels)
+	c.ContractValidation = s.boolean("CONTRACT_VALIDATION", false)
+
+	if len(s.problems) > 0 {
+		return &ConfigError{Problems: s.problems}
+	}
+	return nil
+}
+
+// NewCfAPI returns Cloud Controller client authenticated with client credentials of the discoverer.
+// It is safe for concurrent use and meant to be shared: token is reused until it expires
+// and connections to Cloud Controller and UAA are kept alive.
+func (c *Config) NewCfAPI() *api.CfAPI {
+	transport := c.newTransport()
+	tokenConfig := &clientcredentials.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Scopes:       []string{},
+		TokenURL:     c.TokenURL,
+	}
+	// Tokens are fetched with plain client, Cloud Controller requests go through token source caching the token
+	tokenClient := &http.Client{Transport: transport, Timeout: c.CCTimeout}
+	ctx := context.WithValue(oauth2.NoContext, oauth2.HTTPClient, tokenClient)
+	toReturn := new(api.CfAPI)
+	toReturn.BaseAddress = c.CFAPI
+	toReturn.Client = &http.Client{
+		Transport: &oauth2.Transport{
+			Base:   instrumentTransport(transport),
+			Source: oauth2.ReuseTokenSource(nil, tokenConfig.TokenSource(ctx)),
+		},
+		Timeout: c.CCTimeout,
+	}
+	return toReturn
+}
+
+// NewCallerClient returns Cloud Controller client without credentials of its own,
+// for requests made on behalf of callers with their tokens. Like NewCfAPI it is meant to be shared.
+func (c *Config) NewCallerClient() *http.Client {
+	return &http.Client{Transport: instrumentTransport(c.newTransport()), Timeout: c.CCTimeout}
+}
+
+// newTransport returns transport keeping connections to Cloud Controller and UAA alive
+func (c *Config) newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   c.CCDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: c.CCTLSHandshakeTimeout,
+		IdleConnTimeout:     c.CCIdleConnTimeout,
+		MaxIdleConnsPerHost: c.CCMaxIdleConnsPerHost,
+	}
+}
+
+// settings holds raw values of configuration, read from environment and config file,
+// and collects problems found while parsing them
+type settings struct {
+	values   map[string]string
+	problems []string
+}
+
+// loadFile reads settings from YAML or JSON file, with environment variable names as keys.
+// Lists are joined with commas, other structured values are reported as problems.
+func (s *settings) loadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Cannot read config file: %v", err)
+	}
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &values)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &values)
+	default:
+		return fmt.Errorf("Unknown format of config file %v, use .json, .yml or .yaml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot parse config file %v: %v", path, err)
+	}
+	for key, value := range values {
+		if value == nil {
+			continue
+		}
+		if scalar, ok := configScalar(value); ok {
+			s.values[key] = scalar
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			s.problem("%v in config file must be a string, number, boolean or list of them", key)
+			continue
+		}
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			scalar, ok := configScalar(item)
+			if !ok {
+				s.problem("%v in config file must be a list of strings, numbers or booleans", key)
+				break
+			}
+			items = append(items, scalar)
+		}
+		if len(items) == len(list) {
+			s.values[key] = strings.Join(items, ",")
+		}
+	}
+	log.Infof("Configuration read from %v", path)
+	return nil
+}
+
+// configScalar formats string, number or boolean read from config file
+func configScalar(value interface{}) (string, bool) {
+	switch value.(type) {
+	case string, bool, int, int64, float64:
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
+
+// loadEnv reads settings from environment, overriding those from config file
+func (s *settings) loadEnv() {
+	for _, pair := range os.Environ() {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 && len(parts[1]) > 0 {
+			s.values[parts[0]] = parts[1]
+		}
+	}
+}
+
+func (s *settings) problem(format string, args ...interface{}) {
+	s.problems = append(s.problems, fmt.Sprintf(format, args...))
+}
+
+func (s *settings) optional(key, defaultValue string) string {
+	if value, ok := s.values[key]; ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (s *settings) required(key string) string {
+	value, ok := s.values[key]
+	if !ok {
+		s.problem("%v is required", key)
+	}
+	return value
+}
+
+func (s *settings) url(key string) string {
+	return s.checkURL(key, s.required(key))
+}
+
+func (s *settings) optionalURL(key, defaultValue string) string {
+	if _, ok := s.values[key]; !ok {
+		return defaultValue
+	}
+	return s.checkURL(key, s.values[key])
+}
+
+func (s *settings) checkURL(key, value string) string {
+	if len(value) == 0 {
+		return value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || !parsed.IsAbs() || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		s.problem("%v must be an absolute http or https URL, got [%v]", key, value)
+	}
+	return strings.TrimSuffix(value, "/")
+}
+
+func (s *settings) positiveInt(key string, defaultValue int) int {
+	value, ok := s.values[key]
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		s.problem("%v must be a positive integer, got [%v]", key, value)
+		return defaultValue
+	}
+	return parsed
+}
+
+func (s *settings) duration(key string, defaultValue time.Duration) time.Duration {
+	value, ok := s.values[key]
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		s.problem("%v must be a positive duration like 30s or 10m, got [%v]", key, value)
+		return defaultValue
+	}
+	return parsed
+}
+
+func (s *settings) boolean(key string, defaultValue bool) bool {
+	value, ok := s.values[key]
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		s.problem("%v must be true or false, got [%v]", key, value)
+		return defaultValue
+	}
+	return parsed
+}
+
+// patterns reads comma separated list of glob patterns
+func (s *settings) patterns(key string) []string {
+	value, ok := s.values[key]
+	if !ok {
+		return nil
+	}
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); len(pattern) > 0 {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if err := graph.ValidatePatterns(patterns); err != nil {
+		s.problem("%v: %v", key, err)
+	}
+	return patterns
+}
+
+func (s *settings) oneOf(key, defaultValue string, allowed []string) string {
+	value, ok := s.values[key]
+	if !ok {
+		return defaultValue
+	}
+	for _, candidate := range allowed {
+		if strings.ToLower(value) == candidate {
+			return candidate
+		}
+	}
+	s.problem("%v must be one of %v, got [%v]", key, strings.Join(allowed, ", "), value)
+	return defaultValue
 }
@@ -0,0 +1,157 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "discoverer-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileJoinsLists(t *testing.T) {
+	path := writeConfigFile(t, "config.yml", `
+CLIENT_ID: discoverer
+DISCOVERY_PARALLELISM: 8
+CONTRACT_VALIDATION: true
+CREDENTIAL_KEYS_ALLOW:
+  - "*url*"
+  - backend
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	s := &settings{values: make(map[string]string)}
+	if err := s.loadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.problems) > 0 {
+		t.Fatalf("unexpected problems: %v", s.problems)
+	}
+	expected := map[string]string{
+		"CLIENT_ID":             "discoverer",
+		"DISCOVERY_PARALLELISM": "8",
+		"CONTRACT_VALIDATION":   "true",
+		"CREDENTIAL_KEYS_ALLOW": "*url*,backend",
+	}
+	if !reflect.DeepEqual(s.values, expected) {
+		t.Errorf("expected %v, got %v", expected, s.values)
+	}
+	if patterns := s.patterns("CREDENTIAL_KEYS_ALLOW"); !reflect.DeepEqual(patterns, []string{"*url*", "backend"}) {
+		t.Errorf("unexpected patterns %v", patterns)
+	}
+}
+
+func TestLoadFileRejectsStructuredValues(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{
+		"CLIENT_ID": {"name": "discoverer"},
+		"CREDENTIAL_KEYS_DENY": [["*password*"]],
+		"CLIENT_SECRET": "secret"
+	}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	s := &settings{values: make(map[string]string)}
+	if err := s.loadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.problems) != 2 {
+		t.Errorf("expected problems with CLIENT_ID and CREDENTIAL_KEYS_DENY, got %v", s.problems)
+	}
+	if _, ok := s.values["CLIENT_ID"]; ok {
+		t.Error("map value should not be flattened")
+	}
+	if _, ok := s.values["CREDENTIAL_KEYS_DENY"]; ok {
+		t.Error("nested list should not be flattened")
+	}
+	if s.values["CLIENT_SECRET"] != "secret" {
+		t.Errorf("unexpected CLIENT_SECRET %v", s.values["CLIENT_SECRET"])
+	}
+}
+
+// setenv sets environment variables for the test, restoring previous values when it finishes
+func setenv(values map[string]string) func() {
+	saved := map[string]string{}
+	for key, value := range values {
+		saved[key] = os.Getenv(key)
+		if len(value) > 0 {
+			os.Setenv(key, value)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+	return func() {
+		for key, value := range saved {
+			if len(value) > 0 {
+				os.Setenv(key, value)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+	}
+}
+
+func TestInitializeRequiresBasicAuthConsumer(t *testing.T) {
+	required := map[string]string{
+		"CONFIG_FILE":      "",
+		"CF_API":           "https://api.example.com",
+		"TOKEN_URL":        "https://uaa.example.com/oauth/token",
+		"CLIENT_ID":        "discoverer",
+		"CLIENT_SECRET":    "secret",
+		"AUTH_USER":        "",
+		"AUTH_PASS":        "",
+		"API_CLIENTS":      "",
+		"API_CLIENTS_FILE": "",
+		"AUTH_BEARER_ONLY": "",
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		problem bool
+	}{
+		{"no consumer", map[string]string{}, true},
+		{"legacy consumer", map[string]string{"AUTH_USER": "admin", "AUTH_PASS": "password"}, false},
+		{"api client", map[string]string{"API_CLIENTS": `[{"name": "ci", "secretHash": "$2y$10$0H1nAzZQzHeT3lN7YdV9xOq3B8WvQ8vB2W7mX9rjkWq0mM2W7a1bK"}]`}, false},
+		{"bearer only", map[string]string{"AUTH_BEARER_ONLY": "true"}, false},
+		{"bearer only with consumer", map[string]string{"AUTH_BEARER_ONLY": "true", "AUTH_USER": "admin", "AUTH_PASS": "password"}, true},
+	}
+	for _, test := range tests {
+		restore := setenv(required)
+		restoreTest := setenv(test.env)
+		c := Config{}
+		err := c.Initialize(nil)
+		restoreTest()
+		restore()
+		if test.problem && err == nil {
+			t.Errorf("%v: expected config problem", test.name)
+		}
+		if !test.problem && err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+		}
+	}
+}
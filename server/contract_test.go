@@ -0,0 +1,196 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"github.com/trustedanalytics/app-dependency-discoverer/openapi"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// envLinkStack returns stack whose root app points to orders app through URL in its environment,
+// besides URLs of itself and of unknown host. With cycle orders app points back to root app.
+func envLinkStack(cycle bool) cftest.Stack {
+	orders := cftest.App{GUID: "orders-guid", Name: "orders", Routes: []cftest.Route{{Host: "orders"}},
+		Bindings: []string{"db-guid"}}
+	if cycle {
+		orders.Env = map[string]interface{}{"ROOT": "http://root." + cftest.DefaultDomain}
+	}
+	root := cftest.App{GUID: "root-guid", Name: "root", Routes: []cftest.Route{{Host: "root"}},
+		Env: map[string]interface{}{
+			"ORDERS_API": "https://orders." + cftest.DefaultDomain,
+			"SELF_URL":   "http://root." + cftest.DefaultDomain,
+			"OTHER":      "http://nowhere." + cftest.DefaultDomain,
+			"PLAIN":      "value",
+		}}
+	return cftest.Stack{
+		Apps:     []cftest.App{root, orders},
+		Services: []cftest.Service{{GUID: "db-guid", Name: "db", Label: "postgresql93", Plan: "free"}},
+	}
+}
+
+// contractClient makes requests to the discoverer served through openapi.Validating,
+// collecting statuses of responses and violations of the specification
+type contractClient struct {
+	t          *testing.T
+	discoverer *httptest.Server
+	mutex      sync.Mutex
+	statuses   map[int]bool
+	violations []openapi.Violation
+}
+
+func newContractClient(t *testing.T) *contractClient {
+	return &contractClient{t: t, statuses: map[int]bool{}}
+}
+
+// start runs the discoverer for the stack through newWrappedTestServer
+func (c *contractClient) start(stack cftest.Stack, settings map[string]string) (*cftest.Server, func()) {
+	doc := openapi.MustParse(openapi.Spec)
+	fake, discoverer, stop := newWrappedTestServer(c.t, stack, settings, func(handler http.Handler) http.Handler {
+		return doc.Validating(handler, c.report)
+	})
+	c.discoverer = discoverer
+	return fake, stop
+}
+
+func (c *contractClient) report(violation openapi.Violation) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.violations = append(c.violations, violation)
+}
+
+// do sends the request, authenticated with basic authentication unless token is given or is "-"
+func (c *contractClient) do(method, path, body, token string) (int, []byte) {
+	req, err := http.NewRequest(method, c.discoverer.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	switch token {
+	case "":
+		req.SetBasicAuth(testUser, testPassword)
+	case "-":
+	default:
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.statuses[resp.StatusCode] = true
+	return resp.StatusCode, content
+}
+
+// submit starts discovery job and reads it until it is finished
+func (c *contractClient) submit(body string) {
+	status, content := c.do("POST", "/v2/discoveries", body, "")
+	if status != http.StatusAccepted {
+		return
+	}
+	job := Job{}
+	if err := json.Unmarshal(content, &job); err != nil {
+		c.t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		_, content = c.do("GET", "/v2/discoveries/"+job.ID, "", "")
+		if err := json.Unmarshal(content, &job); err != nil {
+			c.t.Fatal(err)
+		}
+		if job.State == JobSucceeded || job.State == JobFailed {
+			return
+		}
+	}
+	c.t.Errorf("job %v for %s did not finish", job.ID, body)
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	v1Queries := []string{"", "?waves=true", "?cycles=defer", "?cycles=defer&waves=true", "?errors=tolerant",
+		"?format=dot", "?format=svg", "?format=events", "?format=events&cycles=defer", "?cycles=bad", "?format=bad"}
+	v2Queries := []string{"", "?waves=true", "?cycles=defer", "?errors=tolerant", "?format=dot",
+		"?format=events&cycles=defer", "?envLinks=true", "?envLinks=true&cycles=defer", "?envLinks=yes"}
+	jobs := []string{`{"rootGUID": "root-guid"}`, `{"rootGUID": "root-guid", "waves": true}`,
+		`{"rootGUID": "root-guid", "details": true, "envLinks": true, "cycles": "defer"}`,
+		`{"rootGUID": "missing-guid"}`, `{"rootGUID": "root-guid", "callbackURL": "http://localhost:1/"}`,
+		`{"rootGUID": ""}`, `{`}
+
+	client := newContractClient(t)
+	stacks := map[string]cftest.Stack{"diamond": cftest.DiamondStack(), "dangling": cftest.DanglingStack(),
+		"cycle": cftest.CycleStack(), "env links": envLinkStack(false), "env link cycle": envLinkStack(true)}
+	for _, stack := range stacks {
+		// Readiness is checked anew on every request
+		fake, stop := client.start(stack, map[string]string{"READINESS_CACHE_TTL": "1ns"})
+		for _, query := range v1Queries {
+			client.do("GET", "/v1/discover/root-guid"+query, "", "")
+		}
+		for _, query := range v2Queries {
+			client.do("GET", "/v2/discover/root-guid"+query, "", "")
+		}
+		for _, job := range jobs {
+			client.submit(job)
+		}
+		client.do("GET", "/v1/discover/missing-guid", "", "")
+		client.do("GET", "/v2/discover/missing-guid", "", "")
+		client.do("GET", "/v2/discoveries/missing-id", "", "")
+		client.do("GET", "/v1/discover/root-guid", "", "-")
+		client.do("GET", "/v1/discover/root-guid", "", userToken(fake, "nobody"))
+		client.do("GET", "/healthz", "", "-")
+		client.do("GET", "/readyz", "", "-")
+		client.do("GET", "/metrics", "", "")
+		client.do("GET", "/metrics", "", "-")
+		client.do("GET", "/v1/swagger.json", "", "-")
+		client.do("GET", "/missing", "", "")
+
+		// Discovery failing on Cloud Controller errors and Cloud Controller not ready
+		fake.Fail("/v2/apps/root-guid/summary")
+		client.do("GET", "/v1/discover/root-guid", "", "")
+		client.do("GET", "/v2/discover/root-guid", "", "")
+		client.submit(`{"rootGUID": "root-guid"}`)
+		fake.Fail("/v2/info")
+		client.do("GET", "/readyz", "", "-")
+		stop()
+	}
+
+	// Requests over the limit
+	_, stop := client.start(cftest.DiamondStack(), map[string]string{"RATE_LIMIT": "1", "RATE_LIMIT_BURST": "1"})
+	for _, path := range []string{"/v1/discover/root-guid", "/v2/discover/root-guid", "/metrics", "/v2/discoveries/missing-id"} {
+		client.do("GET", path, "", "")
+	}
+	client.do("POST", "/v2/discoveries", `{"rootGUID": "root-guid"}`, "")
+	stop()
+
+	for _, violation := range client.violations {
+		t.Errorf("%v %v responded with %v not matching the specification: %v",
+			violation.Method, violation.Path, violation.Status, strings.Join(violation.Problems, "; "))
+	}
+	for _, status := range []int{200, 202, 400, 401, 403, 404, 409, 429, 500, 503} {
+		if !client.statuses[status] {
+			t.Errorf("no response with status %v was checked", status)
+		}
+	}
+}
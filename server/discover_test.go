@@ -0,0 +1,374 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Credentials of the legacy API consumer configured for test servers
+const (
+	testUser     = "admin"
+	testPassword = "password"
+)
+
+func TestMain(m *testing.M) {
+	log.ReplaceLogger(log.Disabled)
+	os.Exit(m.Run())
+}
+
+// newTestServer starts the discoverer talking to fake Cloud Controller serving the stack, configured
+// like in production through environment, with given settings added. Returned function stops both.
+func newTestServer(t *testing.T, stack cftest.Stack, settings map[string]string) (*cftest.Server, *httptest.Server, func()) {
+	return newWrappedTestServer(t, stack, settings, func(handler http.Handler) http.Handler { return handler })
+}
+
+// newWrappedTestServer is newTestServer serving the discoverer through handler returned by wrap
+func newWrappedTestServer(t *testing.T, stack cftest.Stack, settings map[string]string,
+	wrap func(http.Handler) http.Handler) (*cftest.Server, *httptest.Server, func()) {
+	fake := cftest.NewServer(stack)
+	env := map[string]string{
+		"CONFIG_FILE":      "",
+		"CF_API":           fake.CC.URL,
+		"TOKEN_URL":        fake.TokenURL(),
+		"CLIENT_ID":        cftest.ClientID,
+		"CLIENT_SECRET":    cftest.ClientSecret,
+		"AUTH_USER":        testUser,
+		"AUTH_PASS":        testPassword,
+		"API_CLIENTS":      "",
+		"API_CLIENTS_FILE": "",
+		"AUTH_BEARER_ONLY": "",
+	}
+	for key, value := range settings {
+		env[key] = value
+	}
+	restore := setenv(env)
+	config := Config{}
+	if err := config.Initialize(nil); err != nil {
+		restore()
+		fake.Close()
+		t.Fatal(err)
+	}
+	discoverer := httptest.NewServer(wrap(NewRouter(config)))
+	return fake, discoverer, func() {
+		discoverer.Close()
+		fake.Close()
+		restore()
+	}
+}
+
+// get requests the path from the discoverer as the legacy API consumer, or with bearer token if given
+func get(t *testing.T, discoverer *httptest.Server, path, token string) (*http.Response, []byte) {
+	req, err := http.NewRequest("GET", discoverer.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.SetBasicAuth(testUser, testPassword)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+// testComponent holds fields of discovered component checked by tests
+type testComponent struct {
+	GUID         string   `json:"GUID"`
+	Name         string   `json:"name"`
+	DependencyOf []string `json:"dependencyOf"`
+}
+
+func TestDiscoverFixtures(t *testing.T) {
+	tests := []struct {
+		name       string
+		stack      cftest.Stack
+		status     int
+		components []testComponent
+	}{
+		{"diamond", cftest.DiamondStack(), http.StatusOK, []testComponent{
+			{"db-guid", "db", []string{"left-guid", "right-guid"}},
+			{"shared-guid", "shared", []string{"shared-ups-guid"}},
+			{"shared-ups-guid", "shared-ups", []string{"left-guid", "right-guid"}},
+			{"left-guid", "left", []string{"left-ups-guid"}},
+			{"left-ups-guid", "left-ups", []string{"root-guid"}},
+			{"right-guid", "right", []string{"right-ups-guid"}},
+			{"right-ups-guid", "right-ups", []string{"root-guid"}},
+			{"root-guid", "root", []string{}},
+		}},
+		{"dangling", cftest.DanglingStack(), http.StatusOK, []testComponent{
+			{"unknown-ups-guid", "unknown-ups", []string{"root-guid"}},
+			{"unmapped-ups-guid", "unmapped-ups", []string{"root-guid"}},
+			{"no-url-ups-guid", "no-url-ups", []string{"root-guid"}},
+			{"number-ups-guid", "number-ups", []string{"root-guid"}},
+			{"root-guid", "root", []string{}},
+		}},
+		{"cycle", cftest.CycleStack(), http.StatusConflict, nil},
+	}
+	for _, test := range tests {
+		_, discoverer, stop := newTestServer(t, test.stack, nil)
+		resp, body := get(t, discoverer, "/v1/discover/root-guid", "")
+		stop()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%v: expected status %v, got %v: %s", test.name, test.status, resp.StatusCode, body)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		components := []testComponent{}
+		if err := json.Unmarshal(body, &components); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(components, test.components) {
+			t.Errorf("%v: expected components %+v, got %+v", test.name, test.components, components)
+		}
+	}
+}
+
+func TestDiscoverCycleConflict(t *testing.T) {
+	_, discoverer, stop := newTestServer(t, cftest.CycleStack(), nil)
+	defer stop()
+
+	resp, body := get(t, discoverer, "/v1/discover/root-guid", "")
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status 409, got %v: %s", resp.StatusCode, body)
+	}
+	conflict := CycleConflictError{}
+	if err := json.Unmarshal(body, &conflict); err != nil {
+		t.Fatal(err)
+	}
+	if len(conflict.Cycles) != 1 || len(conflict.Cycles[0].Components) != 4 {
+		t.Fatalf("expected a cycle of 4 components, got %+v", conflict.Cycles)
+	}
+	names := []string{}
+	for _, component := range conflict.Cycles[0].Components {
+		names = append(names, component.Name)
+	}
+	if expected := []string{"root", "backend-ups", "backend", "root-ups"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected cycle %v, got %v", expected, names)
+	}
+}
+
+func TestDiscoverEnvLinkCycleCannotBeDeferred(t *testing.T) {
+	_, discoverer, stop := newTestServer(t, envLinkStack(true), nil)
+	defer stop()
+
+	resp, body := get(t, discoverer, "/v2/discover/root-guid?envLinks=true&cycles=defer", "")
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status 409, got %v: %s", resp.StatusCode, body)
+	}
+	conflict := CycleConflictError{}
+	if err := json.Unmarshal(body, &conflict); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(conflict.Error, "environment of applications cannot be deferred") || len(conflict.Cycles) != 1 {
+		t.Errorf("expected a cycle which cannot be deferred due to environment links, got %s", body)
+	}
+}
+
+func TestDiscoverErrorModes(t *testing.T) {
+	failing := []string{"/v2/apps/left-guid/summary", "/v2/user_provided_service_instances/right-ups-guid"}
+	tests := []struct {
+		query    string
+		status   int
+		warnings []string
+	}{
+		{"", http.StatusInternalServerError, nil},
+		{"?errors=strict", http.StatusInternalServerError, nil},
+		{"?errors=tolerant", http.StatusOK, []string{"left-ups-guid", "right-ups-guid"}},
+	}
+	for _, test := range tests {
+		fake, discoverer, stop := newTestServer(t, cftest.DiamondStack(), nil)
+		for _, path := range failing {
+			fake.Fail(path)
+		}
+		resp, body := get(t, discoverer, "/v1/discover/root-guid"+test.query, "")
+		stop()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%v: expected status %v, got %v: %s", test.query, test.status, resp.StatusCode, body)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		plan := DiscoveryPlan{}
+		if err := json.Unmarshal(body, &plan); err != nil {
+			t.Errorf("%v: %v", test.query, err)
+			continue
+		}
+		warnings := []string{}
+		for _, warning := range plan.Warnings {
+			warnings = append(warnings, warning.GUID)
+		}
+		if !reflect.DeepEqual(warnings, test.warnings) {
+			t.Errorf("%v: expected warnings about %v, got %v", test.query, test.warnings, warnings)
+		}
+		// Components behind the failing ones are missing, the rest is discovered
+		guids := []string{}
+		for _, component := range plan.Components {
+			guids = append(guids, component.GUID)
+		}
+		if expected := []string{"left-ups-guid", "right-ups-guid", "root-guid"}; !reflect.DeepEqual(guids, expected) {
+			t.Errorf("%v: expected components %v, got %v", test.query, expected, guids)
+		}
+	}
+}
+
+func TestDiscoverDetailsWithOrganizations(t *testing.T) {
+	tests := []struct {
+		query    string
+		status   int
+		orgs     map[string]string
+		warnings []string
+	}{
+		{"", http.StatusOK, map[string]string{"root-guid": "org-a", "other-ups-guid": "org-a", "other-guid": "org-b"}, []string{}},
+		{"?errors=strict", http.StatusInternalServerError, nil, nil},
+		{"?errors=tolerant", http.StatusOK, map[string]string{"root-guid": "org-a", "other-ups-guid": "org-a", "other-guid": ""},
+			[]string{"other-guid"}},
+	}
+	for _, test := range tests {
+		stack := crossSpaceStack()
+		stack.Orgs = map[string]string{"space-a": "org-a", "space-b": "org-b"}
+		fake, discoverer, stop := newTestServer(t, stack, nil)
+		if test.query != "" {
+			fake.Fail("/v2/spaces/space-b")
+		}
+		resp, body := get(t, discoverer, "/v2/discover/root-guid"+test.query, "")
+		stop()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%v: expected status %v, got %v: %s", test.query, test.status, resp.StatusCode, body)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		// Each space is retrieved once, although it holds many components
+		if calls := fake.Calls(cftest.EndpointSpace); calls != 2 {
+			t.Errorf("%v: expected 2 space lookups, got %v", test.query, calls)
+		}
+		plan := DetailedDiscoveryPlan{}
+		if err := json.Unmarshal(body, &plan); err != nil {
+			t.Errorf("%v: %v", test.query, err)
+			continue
+		}
+		orgs := map[string]string{}
+		for _, component := range plan.Components {
+			switch {
+			case component.App != nil:
+				orgs[component.GUID] = component.App.OrganizationGUID
+			case component.UserProvidedService != nil:
+				orgs[component.GUID] = component.UserProvidedService.OrganizationGUID
+			}
+		}
+		if !reflect.DeepEqual(orgs, test.orgs) {
+			t.Errorf("%v: expected organizations %v, got %v", test.query, test.orgs, orgs)
+		}
+		warnings := []string{}
+		for _, warning := range plan.Warnings {
+			warnings = append(warnings, warning.GUID)
+		}
+		if !reflect.DeepEqual(warnings, test.warnings) {
+			t.Errorf("%v: expected warnings about %v, got %v", test.query, test.warnings, warnings)
+		}
+	}
+}
+
+func TestDiscoverReportsCloudControllerCalls(t *testing.T) {
+	for _, path := range []string{"/v1/discover/root-guid", "/v2/discover/root-guid"} {
+		fake, discoverer, stop := newTestServer(t, cftest.DiamondStack(), nil)
+		fake.ResetCalls()
+		resp, body := get(t, discoverer, path, "")
+		stop()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%v: expected status 200, got %v: %s", path, resp.StatusCode, body)
+			continue
+		}
+
+		// Every app is summarized once, although shared is reached through both left and right
+		if summaries := fake.Calls(cftest.EndpointAppSummary); summaries != 4 {
+			t.Errorf("%v: expected 4 app summaries, got %v", path, summaries)
+		}
+		calls, err := strconv.Atoi(resp.Header.Get("X-CC-Calls"))
+		if err != nil || calls != fake.TotalCalls() {
+			t.Errorf("%v: expected X-CC-Calls %v, got %v", path, fake.TotalCalls(), resp.Header.Get("X-CC-Calls"))
+		}
+		hits, err := strconv.Atoi(resp.Header.Get("X-CC-Cache-Hits"))
+		if err != nil || hits == 0 {
+			t.Errorf("%v: expected cache hits, got %v", path, resp.Header.Get("X-CC-Cache-Hits"))
+			continue
+		}
+		ratio := strconv.FormatFloat(float64(hits)/float64(calls+hits), 'f', 2, 64)
+		if header := resp.Header.Get("X-CC-Cache-Hit-Ratio"); header != ratio {
+			t.Errorf("%v: expected X-CC-Cache-Hit-Ratio %v, got %v", path, ratio, header)
+		}
+	}
+}
+
+func TestDiscoveriesShareUAAToken(t *testing.T) {
+	fake, discoverer, stop := newTestServer(t, cftest.DiamondStack(), nil)
+	defer stop()
+
+	// Requests are made directly, as get cannot stop the test from other goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", discoverer.URL+"/v1/discover/root-guid", nil)
+			req.SetBasicAuth(testUser, testPassword)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("expected status 200, got %v", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	get(t, discoverer, "/v1/discover/root-guid", "")
+
+	if calls := fake.Calls(cftest.EndpointToken); calls != 1 {
+		t.Errorf("expected a single token for all discoveries, UAA was asked %v times", calls)
+	}
+}
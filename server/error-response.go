@@ -19,15 +19,24 @@ package server
 import (
 	"encoding/json"
 	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
 	"net/http"
 )
 
-// ServerError
-// swagger:response serverError
+// ServerError tells why the request failed
+// swagger:model
 type ServerError struct {
+	// required: true
+	Status int `json:"status"`
+	// required: true
+	Error string `json:"error"`
+}
+
+// ServerErrorResponse tells why the request failed
+// swagger:response serverError
+type ServerErrorResponse struct {
 	// in: body
-	Status int    `json:"status"`
-	Error  string `json:"error"`
+	Body ServerError
 }
 
 func respondWithError(w *http.ResponseWriter, status int, errorMsg string) {
@@ -42,3 +51,36 @@ func respondWithError(w *http.ResponseWriter, status int, errorMsg string) {
 		(*w).Write(payload)
 	}
 }
+
+// CycleConflictError lists components and edges forming every cycle of the stack
+// swagger:model
+type CycleConflictError struct {
+	// required: true
+	Status int `json:"status"`
+	// Tells also when cycles=defer could not break cycles, as links through environment cannot be deferred
+	// required: true
+	Error string `json:"error"`
+	// required: true
+	Cycles []graph.Cycle `json:"cycles"`
+}
+
+// CycleConflictResponse lists cycles which made discovery fail
+// swagger:response cycleConflictError
+type CycleConflictResponse struct {
+	// in: body
+	Body CycleConflictError
+}
+
+func respondWithCycles(w *http.ResponseWriter, cycleErr *graph.CycleError) {
+	(*w).WriteHeader(http.StatusConflict)
+	log.Errorf("%v: %+v", cycleErr.Error(), cycleErr.Cycles)
+	msg := CycleConflictError{
+		Status: http.StatusConflict,
+		Error:  cycleErr.Error(),
+		Cycles: cycleErr.Cycles,
+	}
+	payload, err := json.Marshal(msg)
+	if err == nil {
+		(*w).Write(payload)
+	}
+}
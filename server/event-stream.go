@@ -0,0 +1,88 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Names of server-sent events closing the stream
+const (
+	eventResult = "result"
+	eventFailed = "failed"
+)
+
+// eventStream writes server-sent events, one at a time, flushing each one immediately
+type eventStream struct {
+	mu sync.Mutex
+	w  io.Writer
+	id int
+}
+
+func (s *eventStream) send(name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Errorf("Cannot encode %v event: %v", name, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id++
+	if _, err := fmt.Fprintf(s.w, "id: %v\nevent: %v\ndata: %s\n\n", s.id, name, payload); err != nil {
+		log.Debugf("Cannot send %v event: %v", name, err)
+		return
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// streamDiscovery responds with server-sent events reporting every node, edge and url of user provided service
+// as soon as discovery finds it. The stream ends with result event, holding the same body as JSON response would,
+// or with failed event holding the error.
+func (h *Handlers) streamDiscovery(w http.ResponseWriter, rootGUID string, opts graph.Options) {
+	w.Header().Set("Content-Type", formatMediaTypes[formatEvents])
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w}
+	opts.OnEvent = func(event graph.Event) {
+		stream.send(string(event.Type), event)
+	}
+	discovery, err := h.discover(rootGUID, opts)
+	if cycleErr, ok := err.(*graph.CycleError); ok {
+		log.Errorf("%v: %+v", cycleErr.Error(), cycleErr.Cycles)
+		stream.send(eventFailed, CycleConflictError{
+			Status: http.StatusConflict,
+			Error:  cycleErr.Error(),
+			Cycles: cycleErr.Cycles,
+		})
+		return
+	}
+	if err != nil {
+		log.Errorf("Discovery of %v failed: %v", rootGUID, err)
+		stream.send(eventFailed, ServerError{Status: errorStatus(err), Error: err.Error()})
+		return
+	}
+	stream.send(eventResult, discoveryResult(discovery, opts))
+}
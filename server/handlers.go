@@ -18,41 +18,362 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	log "github.com/cihub/seelog"
 	"github.com/go-martini/martini"
 	"github.com/trustedanalytics/app-dependency-discoverer/graph"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
-type Handlers struct{}
+type Handlers struct {
+	config Config
+	// Cloud Controller client shared by all discoveries
+	cf graph.CloudController
+	// Cloud Controller client for requests made with tokens of callers
+	callerClient *http.Client
+	jobs         *JobQueue
+	readiness    *readinessChecker
+}
+
+// NewHandlers returns handlers of all endpoints, discovering stacks with given Cloud Controller client
+// and running asynchronous discoveries on a new job queue
+func NewHandlers(config Config, cf graph.CloudController) *Handlers {
+	toReturn := new(Handlers)
+	toReturn.config = config
+	toReturn.cf = cf
+	toReturn.callerClient = config.NewCallerClient()
+	toReturn.jobs = NewJobQueue(config.JobWorkers, config.JobQueueSize, config.JobResultTTL, toReturn.discover)
+	toReturn.readiness = newReadinessChecker(config)
+	if len(config.CallbackSecret) > 0 {
+		toReturn.jobs.callbacks = newCallbackSender(config.CallbackSecret, config.CallbackAttempts,
+			config.CallbackRetryDelay, config.CallbackTimeout)
+	}
+	return toReturn
+}
 
 // swagger:route GET /v1/discover/{rootGUID} discover
 //
 // Discover dependency tree of specified application in Cloud Foundry, constructs a graph and check for cycles.
 //
 // Privilege level: Consumer of this endpoint must login using basic authentication credentials (valid login and password)
+// or UAA bearer token. Users presenting token may only discover applications in spaces they can read.
 //
 // Returns the list of components to spawn in reversed topological order.
+// If the stack has cycles, responds with conflict listing components and edges forming each cycle.
+// With cycles=defer, cycles are broken by deferring some bindings of user provided services instead,
+// and the plan to create components first and make deferred bindings afterwards is returned.
+// Links found in environment of applications with envLinks=true are not bindings and cannot be deferred:
+// cycles going only through them are rejected with conflict even with cycles=defer, and the error says so.
+// Failure to retrieve any dependency fails discovery, unless errors=tolerant is given:
+// then partial result is returned with warnings naming components which could not be expanded.
+// With waves=true components are also grouped into waves, which can be spawned concurrently one after another.
+// With envLinks=true applications also depend on applications which URLs in their environment point to.
+// With format=dot (or Accept: text/vnd.graphviz) the whole graph is drawn in Graphviz DOT language instead,
+// and with format=svg (or Accept: image/svg+xml) as SVG image, with cycles highlighted.
+// With format=events (or Accept: text/event-stream) progress is streamed as server-sent events:
+// node, edge, url-match, url-miss and error as the stack is retrieved, then result or failed closing the stream.
+// Applications linked from spaces the user cannot read are left out.
+//
+//     Produces:
+//     - application/json
+//     - text/vnd.graphviz
+//     - image/svg+xml
+//     - text/event-stream
+//
+//     Security:
+//       basic:
+//       bearer:
 //
 //     Responses:
 //       200: componentsListResponse
 //       400: serverError
+//       401: serverError
+//       403: serverError
+//       409: cycleConflictError
+//       429: serverError
 //       500: serverError
-func (*Handlers) Discover(w http.ResponseWriter, r *http.Request, params martini.Params) {
+func (h *Handlers) Discover(w http.ResponseWriter, r *http.Request, params martini.Params, caller *Caller) {
+	h.discoverStack(w, r, params, caller, false)
+}
+
+// swagger:route GET /v2/discover/{rootGUID} discoverV2
+//
+// Discover dependency tree of specified application, with details needed to clone every component.
+//
+// Privilege level: Consumer of this endpoint must login using basic authentication credentials (valid login and password)
+// or UAA bearer token. Users presenting token may only discover applications in spaces they can read.
+//
+// Accepts the same options as /v1/discover, but always returns the full plan. Apart from fields of v1 components,
+// applications have space, organization, state, memory, disk quota, instances, buildpack, command and routes,
+// services have label and plan, and user provided services have space, organization and credential keys,
+// with values redacted. Organizations are found by retrieving spaces, once per space.
+// Dependencies between components are listed as edges of kind binding, or ups-url for applications whose route
+// matches url in credentials of user provided service, or env-url for applications linked from environment
+// of another one, with the credential key or environment variable, url and the route as evidence.
+// Cycles going only through env-url edges cannot be deferred and are rejected with conflict even with cycles=defer.
+//
+//     Produces:
+//     - application/json
+//     - text/vnd.graphviz
+//     - image/svg+xml
+//     - text/event-stream
+//
+//     Security:
+//       basic:
+//       bearer:
+//
+//     Responses:
+//       200: detailedDiscoveryResponse
+//       400: serverError
+//       401: serverError
+//       403: serverError
+//       409: cycleConflictError
+//       429: serverError
+//       500: serverError
+func (h *Handlers) DiscoverV2(w http.ResponseWriter, r *http.Request, params martini.Params, caller *Caller) {
+	h.discoverStack(w, r, params, caller, true)
+}
+
+// discoverStack responds with discovery of the stack, in format requested
+func (h *Handlers) discoverStack(w http.ResponseWriter, r *http.Request, params martini.Params, caller *Caller,
+	details bool) {
+
 	if _, ok := params["rootGUID"]; !ok {
 		respondWithError(&w, http.StatusBadRequest, "No root GUID provided")
 		return
 	}
 
-	api := graph.NewGraphAPI()
-	result, err := api.Discover(params["rootGUID"])
+	opts, err := parseOptions(r)
 	if err != nil {
-		respondWithError(&w, http.StatusInternalServerError, err.Error())
+		respondWithError(&w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Details = details
+
+	format, err := parseFormat(r)
+	if err != nil {
+		respondWithError(&w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.limitToCaller(caller, &opts)
+
+	if format == formatEvents {
+		h.streamDiscovery(w, params["rootGUID"], opts)
+		return
+	}
+	if format != formatJSON {
+		h.renderDiagram(w, h.newGraphAPI(), params["rootGUID"], opts, format)
+		return
+	}
+
+	discovery, err := h.discover(params["rootGUID"], opts)
+	if cycleErr, ok := err.(*graph.CycleError); ok {
+		respondWithCycles(&w, cycleErr)
 		return
 	}
+	if err != nil {
+		respondWithError(&w, errorStatus(err), err.Error())
+		return
+	}
+	writeLookupStats(w, discovery.Stats)
+	result := discoveryResult(discovery, opts)
 	log.Debugf("Sent: %v", result)
 
 	w.WriteHeader(http.StatusOK)
 	encoder := json.NewEncoder(w)
 	encoder.Encode(result)
 }
+
+// swagger:route POST /v2/discoveries createDiscovery
+//
+// Start asynchronous discovery of dependency tree of specified application.
+//
+// Meant for stacks too large to be discovered within a single request.
+//
+// Privilege level: Consumer of this endpoint must login using basic authentication credentials (valid login and password)
+// or UAA bearer token. Discovery started by user fails if the user cannot read space of the application.
+//
+// Accepts root GUID with the same options as synchronous discovery and returns the pending job.
+// With details=true the result is the same as of /v2/discover.
+// Its status can be polled at the URL given in Location header. When too many jobs are waiting, responds with 503.
+// If callbackURL is given, final status of the job is also posted there, signed with HMAC-SHA256 of shared secret
+// in X-Discoverer-Signature header. Failed deliveries are retried with exponential backoff.
+//
+//     Security:
+//       basic:
+//       bearer:
+//
+//     Responses:
+//       202: discoveryJobResponse
+//       400: serverError
+//       401: serverError
+//       403: serverError
+//       429: serverError
+//       500: serverError
+//       503: serverError
+func (h *Handlers) CreateDiscovery(w http.ResponseWriter, r *http.Request, caller *Caller) {
+	request := DiscoveryJobRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(&w, http.StatusBadRequest, "Invalid discovery request: "+err.Error())
+		return
+	}
+	if len(request.RootGUID) == 0 {
+		respondWithError(&w, http.StatusBadRequest, "No root GUID provided")
+		return
+	}
+	opts := graph.Options{Cycles: request.Cycles, Errors: request.Errors, Waves: request.Waves,
+		Details: request.Details, EnvLinks: request.EnvLinks}
+	if err := checkOptions(&opts); err != nil {
+		respondWithError(&w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(request.CallbackURL) > 0 {
+		if h.jobs.callbacks == nil {
+			respondWithError(&w, http.StatusBadRequest, "Callbacks are not enabled")
+			return
+		}
+		if callbackURL, err := url.Parse(request.CallbackURL); err != nil || !callbackURL.IsAbs() ||
+			(callbackURL.Scheme != "http" && callbackURL.Scheme != "https") {
+			respondWithError(&w, http.StatusBadRequest, fmt.Sprintf("Invalid callback URL [%v]", request.CallbackURL))
+			return
+		}
+	}
+
+	h.limitToCaller(caller, &opts)
+
+	job, err := h.jobs.Submit(request.RootGUID, opts, request.CallbackURL, caller.identity())
+	if err == errQueueFull {
+		respondWithError(&w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(&w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/%v/discoveries/%v", apiVersionAsync, job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// swagger:route GET /v2/discoveries/{id} getDiscovery
+//
+// Get status of asynchronous discovery, with progress counters and, once it succeeded, the result.
+//
+// Privilege level: Consumer of this endpoint must login using basic authentication credentials (valid login and password)
+// or UAA bearer token
+//
+// Finished jobs are kept for limited time only, afterwards 404 is returned.
+// Only the caller who started the discovery can read it, 404 is returned to others.
+//
+//     Security:
+//       basic:
+//       bearer:
+//
+//     Responses:
+//       200: discoveryJobResponse
+//       401: serverError
+//       403: serverError
+//       404: serverError
+//       429: serverError
+func (h *Handlers) GetDiscovery(w http.ResponseWriter, params martini.Params, caller *Caller) {
+	job, ok := h.jobs.Get(params["id"], caller.identity())
+	if !ok {
+		respondWithError(&w, http.StatusNotFound, fmt.Sprintf("Discovery [%v] not found", params["id"]))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// limitToCaller restricts discovery to spaces the caller can read, if the caller is a user presenting token.
+// Clients and consumers using basic authentication discover with privileges of the discoverer.
+func (h *Handlers) limitToCaller(caller *Caller, opts *graph.Options) {
+	if caller == nil || len(caller.UserID) == 0 {
+		return
+	}
+	opts.CanReadSpace = newSpaceAccess(h.config.CFAPI, caller.Token, h.callerClient).canRead
+}
+
+func (h *Handlers) newGraphAPI() *graph.GraphAPI {
+	graphAPI := graph.NewGraphAPI(h.cf)
+	graphAPI.Parallelism = h.config.Parallelism
+	graphAPI.Credentials = graph.CredentialScanner{
+		Allow: h.config.CredentialKeysAllow,
+		Deny:  h.config.CredentialKeysDeny,
+	}
+	return graphAPI
+}
+
+func (h *Handlers) discover(rootGUID string, opts graph.Options) (*graph.Discovery, error) {
+	start := time.Now()
+	discovery, err := h.newGraphAPI().Discover(rootGUID, opts)
+	recordDiscovery(start, opts, discovery, err)
+	return discovery, err
+}
+
+// discoveryResult returns plain list of components, or full discovery plan if options require it
+func discoveryResult(discovery *graph.Discovery, opts graph.Options) interface{} {
+	if opts.Details {
+		return DetailedDiscoveryPlan{
+			Components:       discovery.Details,
+			Edges:            discovery.DependencyEdges,
+			DeferredBindings: discovery.DeferredBindings,
+			Waves:            discovery.Waves,
+			Warnings:         discovery.Warnings,
+		}
+	}
+	if !isPlanRequested(opts) {
+		return discovery.Components
+	}
+	return DiscoveryPlan{
+		Components:       discovery.Components,
+		DeferredBindings: discovery.DeferredBindings,
+		Waves:            discovery.Waves,
+		Warnings:         discovery.Warnings,
+	}
+}
+
+// renderDiagram responds with the whole dependency graph drawn in given format, even if it has cycles
+func (h *Handlers) renderDiagram(w http.ResponseWriter, graphAPI *graph.GraphAPI, rootGUID string,
+	opts graph.Options, format string) {
+
+	start := time.Now()
+	diagram, err := graphAPI.Diagram(rootGUID, opts)
+	recordDiagram(start, opts, diagram, err)
+	if err != nil {
+		respondWithError(&w, errorStatus(err), err.Error())
+		return
+	}
+	writeLookupStats(w, diagram.Stats)
+	w.Header().Set("Content-Type", formatMediaTypes[format]+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if format == formatSVG {
+		err = diagram.WriteSVG(w)
+	} else {
+		err = diagram.WriteDOT(w)
+	}
+	if err != nil {
+		log.Errorf("Failed to write diagram: %v", err)
+	}
+}
+
+// errorStatus returns status code of response to failed discovery
+func errorStatus(err error) int {
+	if _, ok := err.(*graph.AccessError); ok {
+		return http.StatusForbidden
+	}
+	if _, ok := err.(*graph.TokenRejectedError); ok {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// writeLookupStats reports Cloud Controller usage of the discovery in response headers
+func writeLookupStats(w http.ResponseWriter, stats graph.LookupStats) {
+	w.Header().Set("X-CC-Calls", strconv.Itoa(stats.Calls))
+	w.Header().Set("X-CC-Cache-Hits", strconv.Itoa(stats.Hits))
+	w.Header().Set("X-CC-Cache-Hit-Ratio", strconv.FormatFloat(stats.HitRatio(), 'f', 2, 64))
+}
@@ -0,0 +1,185 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/cihub/seelog"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Results of readiness checks
+const (
+	checkOK     = "ok"
+	checkFailed = "failed"
+)
+
+const (
+	statusHealthy  = "ok"
+	statusReady    = "ready"
+	statusNotReady = "not ready"
+)
+
+// Dependencies checked for readiness
+const (
+	dependencyUAA             = "uaa"
+	dependencyCloudController = "cloudController"
+)
+
+// CheckResult tells whether a dependency of the discoverer is reachable
+type CheckResult struct {
+	Status   string `json:"status"`
+	URL      string `json:"url"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Readiness is a result of checking all dependencies of the discoverer
+// swagger:model
+type Readiness struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checkedAt"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// readinessChecker verifies that UAA issues token for client credentials and Cloud Controller answers.
+// Results are cached, so that frequent health checks do not load UAA and Cloud Controller.
+type readinessChecker struct {
+	ccURL  string
+	token  *clientcredentials.Config
+	client *http.Client
+	ttl    time.Duration
+
+	mu   sync.Mutex
+	last *Readiness
+}
+
+func newReadinessChecker(config Config) *readinessChecker {
+	toReturn := new(readinessChecker)
+	toReturn.ccURL = config.CFAPI
+	toReturn.token = &clientcredentials.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Scopes:       []string{},
+		TokenURL:     config.TokenURL,
+	}
+	toReturn.client = &http.Client{Timeout: config.ReadinessTimeout}
+	toReturn.ttl = config.ReadinessCacheTTL
+	return toReturn
+}
+
+// check returns cached readiness, checking dependencies again once it is older than TTL
+func (c *readinessChecker) check() Readiness {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil && time.Since(c.last.CheckedAt) < c.ttl {
+		return *c.last
+	}
+
+	readiness := &Readiness{Status: statusReady, Checks: make(map[string]CheckResult)}
+	var wg sync.WaitGroup
+	var resultsMu sync.Mutex
+	for name, check := range map[string]func() (string, error){
+		dependencyUAA:             c.checkUAA,
+		dependencyCloudController: c.checkCloudController,
+	} {
+		wg.Add(1)
+		go func(name string, check func() (string, error)) {
+			defer wg.Done()
+			start := time.Now()
+			url, err := check()
+			result := CheckResult{Status: checkOK, URL: url, Duration: time.Since(start).String()}
+			if err != nil {
+				log.Errorf("Readiness check of %v failed: %v", name, err)
+				result.Status = checkFailed
+				result.Error = err.Error()
+			}
+			resultsMu.Lock()
+			readiness.Checks[name] = result
+			resultsMu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	for _, result := range readiness.Checks {
+		if result.Status != checkOK {
+			readiness.Status = statusNotReady
+		}
+	}
+	readiness.CheckedAt = time.Now().UTC()
+	c.last = readiness
+	return *readiness
+}
+
+// checkUAA obtains a new token for client credentials of the discoverer
+func (c *readinessChecker) checkUAA() (string, error) {
+	ctx := context.WithValue(oauth2.NoContext, oauth2.HTTPClient, c.client)
+	_, err := c.token.Token(ctx)
+	return c.token.TokenURL, err
+}
+
+// checkCloudController requests Cloud Controller info, which does not require authentication
+func (c *readinessChecker) checkCloudController() (string, error) {
+	url := c.ccURL + "/v2/info"
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return url, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return url, fmt.Errorf("Cloud Controller responded with %v", resp.Status)
+	}
+	info := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return url, fmt.Errorf("Invalid Cloud Controller info: %v", err)
+	}
+	return url, nil
+}
+
+// swagger:route GET /healthz healthz
+//
+// Tell that the discoverer is running. Does not require authentication.
+//
+//	Responses:
+//	  200: healthResponse
+func (h *Handlers) Health(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": statusHealthy})
+}
+
+// swagger:route GET /readyz readyz
+//
+// Tell whether the discoverer can serve discoveries: UAA issues token for its client credentials
+// and Cloud Controller answers. Does not require authentication. Results are cached for a short time.
+//
+//	Responses:
+//	  200: readinessResponse
+//	  503: readinessResponse
+func (h *Handlers) Ready(w http.ResponseWriter) {
+	readiness := h.readiness.check()
+	status := http.StatusOK
+	if readiness.Status != statusReady {
+		status = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(readiness)
+}
@@ -0,0 +1,309 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"github.com/trustedanalytics/go-cf-lib/types"
+	"sync"
+	"time"
+)
+
+// JobState is a stage of asynchronous discovery job
+// swagger:enum JobState
+type JobState string
+
+const (
+	JobPending   JobState = "pending"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+)
+
+// errQueueFull is returned when no more jobs can wait for a worker
+var errQueueFull = errors.New("Too many discoveries in progress, try again later")
+
+// JobProgress counts applications found and user provided services resolved so far
+type JobProgress struct {
+	Applications         int `json:"applications"`
+	UserProvidedServices int `json:"userProvidedServices"`
+	Errors               int `json:"errors"`
+}
+
+// Job is a status of asynchronous discovery.
+// Result is set once it succeeded and has the same form as response of synchronous discovery with the same options.
+// swagger:model
+type Job struct {
+	// required: true
+	ID string `json:"id"`
+	// required: true
+	RootGUID string `json:"rootGUID"`
+	// required: true
+	State JobState `json:"state"`
+	// required: true
+	Progress JobProgress `json:"progress"`
+	// required: true
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	// Array of Component, DiscoveryPlan or DetailedDiscoveryPlan, like response of synchronous discovery
+	//
+	// Extensions:
+	// ---
+	// x-any-of:
+	//   - type: array
+	//     items:
+	//       $ref: "#/definitions/Component"
+	//   - $ref: "#/definitions/DiscoveryPlan"
+	//   - $ref: "#/definitions/DetailedDiscoveryPlan"
+	// ---
+	Result interface{}   `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Cycles []graph.Cycle `json:"cycles,omitempty"`
+	// Delivery of final status to callback URL, if one was given
+	Callback *CallbackStatus `json:"callback,omitempty"`
+
+	// Identity of the caller who started the job, the only one allowed to read it
+	owner string
+}
+
+type jobRequest struct {
+	id          string
+	rootGUID    string
+	opts        graph.Options
+	callbackURL string
+}
+
+// discoverFunc runs a single discovery
+type discoverFunc func(rootGUID string, opts graph.Options) (*graph.Discovery, error)
+
+// JobQueue runs discovery jobs on a fixed number of workers.
+// Jobs waiting for a worker are limited, and finished jobs are forgotten after result TTL.
+type JobQueue struct {
+	discover discoverFunc
+	ttl      time.Duration
+	queue    chan jobRequest
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	// Sends status of finished jobs to their callback URLs, if set
+	callbacks *callbackSender
+}
+
+// NewJobQueue starts workers running discoveries with given function. At least one worker is started
+// and at least one job can wait.
+func NewJobQueue(workers, size int, ttl time.Duration, discover discoverFunc) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+	toReturn := new(JobQueue)
+	toReturn.discover = discover
+	toReturn.ttl = ttl
+	toReturn.queue = make(chan jobRequest, size)
+	toReturn.jobs = make(map[string]*Job)
+	for i := 0; i < workers; i++ {
+		go toReturn.work()
+	}
+	return toReturn
+}
+
+// Submit queues discovery of given application stack, started by the owner, and returns its pending job.
+// If callback URL is given, final status of the job is posted to it.
+func (q *JobQueue) Submit(rootGUID string, opts graph.Options, callbackURL, owner string) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{ID: id, RootGUID: rootGUID, State: JobPending, CreatedAt: time.Now().UTC(), owner: owner}
+	if len(callbackURL) > 0 {
+		job.Callback = &CallbackStatus{URL: callbackURL, State: CallbackPending}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	select {
+	case q.queue <- jobRequest{id: id, rootGUID: rootGUID, opts: opts, callbackURL: callbackURL}:
+	default:
+		return Job{}, errQueueFull
+	}
+	q.jobs[id] = job
+	log.Infof("Discovery job %v of %v queued", id, rootGUID)
+	return job.snapshot(), nil
+}
+
+// Get returns current status of the job, unless it is unknown, expired or started by other owner
+func (q *JobQueue) Get(id, owner string) (Job, bool) {
+	job, ok := q.find(id)
+	if !ok || job.owner != owner {
+		return Job{}, false
+	}
+	return job, true
+}
+
+// find returns current status of the job, unless it is unknown or expired
+func (q *JobQueue) find(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.snapshot(), true
+}
+
+// expire forgets finished jobs older than result TTL. Must be called with the lock held.
+func (q *JobQueue) expire() {
+	now := time.Now()
+	for id, job := range q.jobs {
+		if job.ExpiresAt != nil && now.After(*job.ExpiresAt) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *JobQueue) work() {
+	for request := range q.queue {
+		q.run(request)
+	}
+}
+
+func (q *JobQueue) run(request jobRequest) {
+	q.update(request.id, func(job *Job) {
+		started := time.Now().UTC()
+		job.State = JobRunning
+		job.StartedAt = &started
+	})
+	log.Infof("Discovery job %v of %v started", request.id, request.rootGUID)
+
+	opts := request.opts
+	// User provided service with many urls is reported once per url, but counted once.
+	// The set is only touched while updating the job, with the lock held.
+	followed := make(map[string]bool)
+	opts.OnEvent = func(event graph.Event) {
+		q.update(request.id, func(job *Job) {
+			switch event.Type {
+			case graph.EventError:
+				job.Progress.Errors++
+			case graph.EventNode:
+				if event.ComponentType == types.ComponentApp {
+					job.Progress.Applications++
+				}
+			case graph.EventURLMatch, graph.EventURLMiss:
+				if event.ComponentType == types.ComponentUPS && !followed[event.GUID] {
+					followed[event.GUID] = true
+					job.Progress.UserProvidedServices++
+				}
+			}
+		})
+	}
+	discovery, err := q.discover(request.rootGUID, opts)
+
+	q.update(request.id, func(job *Job) {
+		finished := time.Now().UTC()
+		expires := finished.Add(q.ttl)
+		job.FinishedAt = &finished
+		job.ExpiresAt = &expires
+		if err != nil {
+			job.State = JobFailed
+			job.Error = err.Error()
+			if cycleErr, ok := err.(*graph.CycleError); ok {
+				job.Cycles = cycleErr.Cycles
+			}
+			return
+		}
+		job.State = JobSucceeded
+		job.Result = discoveryResult(discovery, request.opts)
+	})
+	if err != nil {
+		log.Errorf("Discovery job %v of %v failed: %v", request.id, request.rootGUID, err)
+	} else {
+		log.Infof("Discovery job %v of %v succeeded", request.id, request.rootGUID)
+	}
+	if len(request.callbackURL) > 0 && q.callbacks != nil {
+		go q.notify(request.id, request.callbackURL)
+	}
+}
+
+// notify posts final status of the job to its callback URL, recording the delivery in the job
+func (q *JobQueue) notify(id, callbackURL string) {
+	job, ok := q.find(id)
+	if !ok {
+		return
+	}
+	// Payload tells about the job, not about its delivery
+	job.Callback = nil
+	body, err := json.Marshal(job)
+	if err != nil {
+		log.Errorf("Cannot encode status of job %v: %v", id, err)
+		return
+	}
+	err = q.callbacks.deliver(callbackURL, id, body, func(attempt int, err error) {
+		q.update(id, func(job *Job) {
+			job.Callback.Attempts = attempt
+			if err != nil {
+				job.Callback.Error = err.Error()
+			}
+		})
+	})
+	q.update(id, func(job *Job) {
+		if err != nil {
+			job.Callback.State = CallbackFailed
+			return
+		}
+		job.Callback.State = CallbackDelivered
+		job.Callback.Error = ""
+	})
+}
+
+func (q *JobQueue) update(id string, change func(job *Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		change(job)
+	}
+}
+
+// snapshot copies the job, so that it can be read without holding the lock
+func (job *Job) snapshot() Job {
+	toReturn := *job
+	if job.Callback != nil {
+		callback := *job.Callback
+		toReturn.Callback = &callback
+	}
+	return toReturn
+}
+
+// newJobID returns random version 4 UUID
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,48 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"testing"
+	"time"
+)
+
+func TestJobReadableOnlyByOwner(t *testing.T) {
+	queue := NewJobQueue(1, 1, time.Minute, func(rootGUID string, opts graph.Options) (*graph.Discovery, error) {
+		return &graph.Discovery{}, nil
+	})
+	owner := &Caller{Name: "alice", Token: "token", UserID: "alice-id"}
+	job, err := queue.Submit("root", graph.Options{}, "", owner.identity())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := queue.Get(job.ID, owner.identity()); !ok {
+		t.Error("owner should read the job")
+	}
+	others := []*Caller{
+		{Name: "bob", Token: "token", UserID: "bob-id"},
+		{Name: "alice", Token: "token"},
+		{Name: "alice"},
+	}
+	for _, other := range others {
+		if _, ok := queue.Get(job.ID, other.identity()); ok {
+			t.Errorf("%+v should not read job of %+v", other, owner)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	log "github.com/cihub/seelog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Tolerated difference between clocks of UAA and the discoverer
+	clockSkew = 30 * time.Second
+	// Token keys are fetched again for unknown key ID no more often than that
+	tokenKeysMinRefresh = 30 * time.Second
+)
+
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// errInsufficientScope is returned for valid tokens without required scope
+var errInsufficientScope = errors.New("Token does not have required scope")
+
+// audience is aud claim, which is either a single string or a list
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = audience(list)
+	return nil
+}
+
+func (a audience) contains(name string) bool {
+	for _, candidate := range a {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenClaims are claims of UAA access token used by the discoverer
+type tokenClaims struct {
+	Subject   string   `json:"sub"`
+	UserID    string   `json:"user_id"`
+	UserName  string   `json:"user_name"`
+	ClientID  string   `json:"client_id"`
+	Scopes    []string `json:"scope"`
+	Audience  audience `json:"aud"`
+	Issuer    string   `json:"iss"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// name identifies the caller: user if token was issued to one, client otherwise
+func (c *tokenClaims) name() string {
+	if len(c.UserName) > 0 {
+		return c.UserName
+	}
+	return c.ClientID
+}
+
+func (c *tokenClaims) hasScope(scope string) bool {
+	for _, candidate := range c.Scopes {
+		if candidate == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenVerifier checks signatures of JWT access tokens against keys published by UAA, and their claims
+type tokenVerifier struct {
+	keysURL  string
+	audience string
+	scope    string
+	issuer   string
+	client   *http.Client
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newTokenVerifier(config Config) *tokenVerifier {
+	toReturn := new(tokenVerifier)
+	toReturn.keysURL = config.UAAURL + "/token_keys"
+	toReturn.audience = config.JWTAudience
+	toReturn.scope = config.JWTScope
+	toReturn.issuer = config.JWTIssuer
+	toReturn.client = &http.Client{Timeout: config.CCTimeout}
+	toReturn.ttl = config.TokenKeysTTL
+	return toReturn
+}
+
+// verify returns claims of valid token. Token without required scope is valid, but errInsufficientScope is returned.
+func (v *tokenVerifier) verify(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Token is not a JWT")
+	}
+	header := struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("Invalid token header: %v", err)
+	}
+	hash, ok := signatureHashes[header.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported token signature algorithm [%v]", header.Algorithm)
+	}
+	key, err := v.key(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid token signature: %v", err)
+	}
+	digest := hash.New()
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, hash, digest.Sum(nil), signature); err != nil {
+		return nil, errors.New("Token signature does not match")
+	}
+
+	claims := new(tokenClaims)
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("Invalid token claims: %v", err)
+	}
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, errors.New("Token is expired")
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, errors.New("Token is not valid yet")
+	}
+	if len(v.issuer) > 0 && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("Token is issued by [%v]", claims.Issuer)
+	}
+	if !claims.Audience.contains(v.audience) {
+		return nil, fmt.Errorf("Token is not intended for [%v]", v.audience)
+	}
+	if !claims.hasScope(v.scope) {
+		return claims, errInsufficientScope
+	}
+	return claims, nil
+}
+
+// key returns public key with given ID, fetching token keys from UAA when cache is stale or key is unknown.
+// If token does not name its key and UAA has exactly one, that one is used.
+func (v *tokenVerifier) key(id string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	stale := v.keys == nil || time.Since(v.fetchedAt) > v.ttl
+	if key, ok := v.lookup(id); ok && !stale {
+		return key, nil
+	}
+	if stale || time.Since(v.fetchedAt) > tokenKeysMinRefresh {
+		keys, err := v.fetchKeys()
+		if err != nil {
+			log.Errorf("Cannot fetch token keys: %v", err)
+			// Keep using previous keys if UAA is temporarily unavailable
+			if key, ok := v.lookup(id); ok {
+				return key, nil
+			}
+			return nil, errors.New("Cannot verify token, token keys are unavailable")
+		}
+		v.keys = keys
+		v.fetchedAt = time.Now()
+	}
+	if key, ok := v.lookup(id); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Token is signed with unknown key [%v]", id)
+}
+
+func (v *tokenVerifier) lookup(id string) (*rsa.PublicKey, bool) {
+	if len(id) == 0 && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[id]
+	return key, ok
+}
+
+// fetchKeys retrieves RSA public keys from UAA token keys endpoint, by key ID
+func (v *tokenVerifier) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	resp, err := v.client.Get(v.keysURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("UAA responded with %v", resp.Status)
+	}
+	response := struct {
+		Keys []struct {
+			KeyID    string `json:"kid"`
+			KeyType  string `json:"kty"`
+			Value    string `json:"value"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range response.Keys {
+		if jwk.KeyType != "RSA" {
+			continue
+		}
+		key, err := parseRSAKey(jwk.Modulus, jwk.Exponent, jwk.Value)
+		if err != nil {
+			log.Warnf("Skipping token key %v: %v", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	log.Infof("Fetched %v token key(s) from %v", len(keys), v.keysURL)
+	return keys, nil
+}
+
+// parseRSAKey builds public key from its modulus and exponent, or from PEM encoded value if they are missing
+func parseRSAKey(modulus, exponent, value string) (*rsa.PublicKey, error) {
+	if len(modulus) > 0 && len(exponent) > 0 {
+		n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(modulus, "="))
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(exponent, "="))
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("no key material")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return key, nil
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, target)
+}
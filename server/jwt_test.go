@@ -0,0 +1,136 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validClaims returns claims of a token accepted with default audience and scope, changed by given ones
+func validClaims(changes map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"user_name": "alice",
+		"user_id":   "alice-id",
+		"aud":       []string{"app_dependency_discoverer", "cloud_controller"},
+		"scope":     []string{"app_dependency_discoverer.read", "cloud_controller.read"},
+	}
+	for name, value := range changes {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestVerifyToken(t *testing.T) {
+	fake := cftest.NewServer(cftest.Stack{})
+	defer fake.Close()
+	// Signs tokens with the same key ID, but a different key
+	impostor := cftest.NewServer(cftest.Stack{})
+	defer impostor.Close()
+
+	verifier := newTokenVerifier(Config{
+		UAAURL:       fake.UAA.URL,
+		JWTAudience:  "app_dependency_discoverer",
+		JWTScope:     "app_dependency_discoverer.read",
+		TokenKeysTTL: time.Minute,
+		CCTimeout:    time.Second,
+	})
+	valid := fake.Token(validClaims(nil))
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"valid", valid, ""},
+		{"audience as string", fake.Token(validClaims(map[string]interface{}{"aud": "app_dependency_discoverer"})), ""},
+		{"expired", fake.Token(validClaims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+			"Token is expired"},
+		{"not valid yet", fake.Token(validClaims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+			"Token is not valid yet"},
+		{"other audience", fake.Token(validClaims(map[string]interface{}{"aud": []string{"cloud_controller"}})),
+			"Token is not intended for [app_dependency_discoverer]"},
+		{"no scope", fake.Token(validClaims(map[string]interface{}{"scope": []string{"cloud_controller.read"}})),
+			errInsufficientScope.Error()},
+		{"other key", impostor.Token(validClaims(nil)), "Token signature does not match"},
+		{"tampered claims", strings.Replace(valid, ".", ".e", 1), "Token signature does not match"},
+		{"not a JWT", "abc", "Token is not a JWT"},
+	}
+	for _, test := range tests {
+		_, err := verifier.verify(test.token)
+		if len(test.err) == 0 && err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+		}
+		if len(test.err) > 0 && (err == nil || !strings.HasPrefix(err.Error(), test.err)) {
+			t.Errorf("%v: expected error %v, got %v", test.name, test.err, err)
+		}
+	}
+	if calls := fake.Calls(cftest.EndpointTokenKeys); calls != 1 {
+		t.Errorf("expected token keys to be fetched once, got %v", calls)
+	}
+}
+
+func TestVerifyTokenIssuer(t *testing.T) {
+	fake := cftest.NewServer(cftest.Stack{})
+	defer fake.Close()
+	verifier := newTokenVerifier(Config{
+		UAAURL:       fake.UAA.URL,
+		JWTAudience:  "app_dependency_discoverer",
+		JWTScope:     "app_dependency_discoverer.read",
+		JWTIssuer:    fake.TokenURL(),
+		TokenKeysTTL: time.Minute,
+		CCTimeout:    time.Second,
+	})
+	if _, err := verifier.verify(fake.Token(validClaims(nil))); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := verifier.verify(fake.Token(validClaims(map[string]interface{}{"iss": "https://other"}))); err == nil {
+		t.Error("token of other issuer should be rejected")
+	}
+}
+
+func TestBearerAuthentication(t *testing.T) {
+	fake, discoverer, stop := newTestServer(t, cftest.DiamondStack(), nil)
+	defer stop()
+
+	tests := []struct {
+		name         string
+		token        string
+		status       int
+		authenticate string
+	}{
+		{"client token", fake.Token(validClaims(map[string]interface{}{"user_name": nil, "user_id": nil,
+			"client_id": "ci"})), http.StatusOK, ""},
+		{"expired", fake.Token(validClaims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})),
+			http.StatusUnauthorized, `error="invalid_token"`},
+		{"other audience", fake.Token(validClaims(map[string]interface{}{"aud": "cloud_controller"})),
+			http.StatusUnauthorized, `error="invalid_token"`},
+		{"no scope", fake.Token(validClaims(map[string]interface{}{"scope": []string{}})),
+			http.StatusForbidden, `error="insufficient_scope"`},
+	}
+	for _, test := range tests {
+		resp, body := get(t, discoverer, "/v1/discover/root-guid", test.token)
+		if resp.StatusCode != test.status {
+			t.Errorf("%v: expected status %v, got %v: %s", test.name, test.status, resp.StatusCode, body)
+		}
+		if challenge := resp.Header.Get("WWW-Authenticate"); !strings.Contains(challenge, test.authenticate) {
+			t.Errorf("%v: expected %v in WWW-Authenticate, got %v", test.name, test.authenticate, challenge)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"github.com/trustedanalytics/app-dependency-discoverer/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outcomes of discovery
+const (
+	outcomeOK     = "ok"
+	outcomeCycle  = "cycle"
+	outcomeDenied = "denied"
+	outcomeError  = "error"
+)
+
+var (
+	latencyBuckets   = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	graphSizeBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+	httpRequests = metrics.NewCounterVec("discoverer_http_requests_total",
+		"HTTP requests served, by endpoint and status code.", "endpoint", "code")
+	httpDuration = metrics.NewHistogramVec("discoverer_http_request_duration_seconds",
+		"Time of serving HTTP requests, by endpoint.", latencyBuckets, "endpoint")
+	contractViolations = metrics.NewCounterVec("discoverer_contract_violations_total",
+		"HTTP responses not matching OpenAPI document, by endpoint. Counted only if contract validation is enabled.",
+		"endpoint")
+	clientRequests = metrics.NewCounterVec("discoverer_client_requests_total",
+		"HTTP requests of authenticated callers, by client, or user for all users, and status code.", "client", "code")
+	rateLimited = metrics.NewCounterVec("discoverer_rate_limited_requests_total",
+		"HTTP requests rejected because caller exceeded its rate limit, by client, or user for all users.", "client")
+
+	discoveries = metrics.NewCounterVec("discoverer_discoveries_total",
+		"Discoveries of application stacks, by outcome: ok, cycle, denied or error.", "outcome")
+	discoveryDuration = metrics.NewHistogramVec("discoverer_discovery_duration_seconds",
+		"Time of discovering application stacks, by outcome: ok, cycle, denied or error.", latencyBuckets, "outcome")
+
+	ccRequests = metrics.NewCounterVec("discoverer_cc_requests_total",
+		"Cloud Controller requests, by endpoint and status code, or error if no response was received.", "endpoint", "code")
+	ccDuration = metrics.NewHistogramVec("discoverer_cc_request_duration_seconds",
+		"Time of Cloud Controller requests, by endpoint.", latencyBuckets, "endpoint")
+
+	graphNodes = metrics.NewHistogramVec("discoverer_graph_nodes",
+		"Number of components in discovered stacks.", graphSizeBuckets)
+	graphEdges = metrics.NewHistogramVec("discoverer_graph_edges",
+		"Number of dependencies between components in discovered stacks.", graphSizeBuckets)
+	cyclesDetected = metrics.NewCounterVec("discoverer_cycles_detected_total",
+		"Cycles found in discovered stacks, by cycles mode: fail or defer.", "mode")
+)
+
+// recordDiscovery updates discovery metrics with the result of discovery started at given time
+func recordDiscovery(start time.Time, opts graph.Options, discovery *graph.Discovery, err error) {
+	outcome := outcomeOK
+	if cycleErr, ok := err.(*graph.CycleError); ok {
+		outcome = outcomeCycle
+		cyclesDetected.Add(float64(len(cycleErr.Cycles)), string(opts.Cycles))
+	} else if _, ok := err.(*graph.AccessError); ok {
+		outcome = outcomeDenied
+	} else if err != nil {
+		outcome = outcomeError
+	}
+	discoveries.Inc(outcome)
+	discoveryDuration.Observe(time.Since(start).Seconds(), outcome)
+	if discovery == nil {
+		return
+	}
+	graphNodes.Observe(float64(len(discovery.Components)))
+	graphEdges.Observe(float64(discovery.Edges))
+	if len(discovery.Cycles) > 0 {
+		cyclesDetected.Add(float64(len(discovery.Cycles)), string(opts.Cycles))
+	}
+}
+
+// recordDiagram updates discovery metrics with the diagram drawn, counting it as discovery of the same stack
+// would be: cycles which are not deferred, or cannot be, fail discovery.
+func recordDiagram(start time.Time, opts graph.Options, diagram *graph.Diagram, err error) {
+	if err != nil {
+		recordDiscovery(start, opts, nil, err)
+		return
+	}
+	if len(diagram.Cycles) > 0 && (opts.Cycles != graph.CyclesDefer || len(diagram.DeferredBindings) == 0) {
+		recordDiscovery(start, opts, nil, &graph.CycleError{Cycles: diagram.Cycles})
+		return
+	}
+	recordDiscovery(start, opts, &graph.Discovery{
+		Components: diagram.Components,
+		Edges:      len(diagram.Edges),
+		Cycles:     diagram.Cycles,
+	}, nil)
+}
+
+// ccEndpoint names Cloud Controller endpoint requested at given path
+func ccEndpoint(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 4 && parts[1] == "apps" && parts[3] == "summary":
+		return "app summary"
+	case len(parts) == 3 && parts[1] == "user_provided_service_instances":
+		return "user provided service"
+	case len(parts) == 3 && parts[1] == "spaces":
+		return "space"
+	case len(parts) == 4 && parts[1] == "spaces" && parts[3] == "routes":
+		return "space routes"
+	case len(parts) == 4 && parts[1] == "routes" && parts[3] == "apps":
+		return "route apps"
+	}
+	return "other"
+}
+
+// instrumentedTransport records count and latency of Cloud Controller requests
+type instrumentedTransport struct {
+	base http.RoundTripper
+}
+
+func instrumentTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &instrumentedTransport{base: base}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := ccEndpoint(req.URL.Path)
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	ccDuration.Observe(time.Since(start).Seconds(), endpoint)
+	if err != nil {
+		ccRequests.Inc(endpoint, "error")
+		return resp, err
+	}
+	ccRequests.Inc(endpoint, strconv.Itoa(resp.StatusCode))
+	return resp, err
+}
+
+// statusRecorder remembers status code of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// httpEndpoint names endpoint of the discoverer requested at given path, without identifiers
+func httpEndpoint(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/"+apiVersion+"/discover/"):
+		return discoverURLPattern
+	case strings.HasPrefix(path, "/"+apiVersionAsync+"/discover/"):
+		return discoverV2URLPattern
+	case path == discoveriesURLPattern:
+		return discoveriesURLPattern
+	case strings.HasPrefix(path, discoveriesURLPattern+"/"):
+		return discoveryJobURLPattern
+	case path == metricsURLPattern, path == healthURLPattern, path == readinessURLPattern, path == specURLPattern:
+		return path
+	}
+	return "other"
+}
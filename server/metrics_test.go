@@ -0,0 +1,83 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// metricValue returns value of the metric with given name and labels, like discoverer_discoveries_total{outcome="ok"},
+// read from the metrics endpoint. Zero is returned for metric not reported yet.
+func metricValue(t *testing.T, body []byte, metric string) float64 {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		if value := strings.TrimPrefix(scanner.Text(), metric+" "); value != scanner.Text() {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return parsed
+		}
+	}
+	return 0
+}
+
+func TestDiagramsAreRecorded(t *testing.T) {
+	tests := []struct {
+		name    string
+		stack   cftest.Stack
+		query   string
+		outcome string
+		sized   bool
+	}{
+		{"dot", cftest.DiamondStack(), "?format=dot", outcomeOK, true},
+		{"svg", cftest.DiamondStack(), "?format=svg", outcomeOK, true},
+		{"cycles", cftest.CycleStack(), "?format=dot", outcomeCycle, false},
+		{"deferred cycles", cftest.CycleStack(), "?format=svg&cycles=defer", outcomeOK, true},
+	}
+	discoveries := func(outcome string) string { return `discoverer_discoveries_total{outcome="` + outcome + `"}` }
+	durations := func(outcome string) string {
+		return `discoverer_discovery_duration_seconds_count{outcome="` + outcome + `"}`
+	}
+	for _, test := range tests {
+		_, discoverer, stop := newTestServer(t, test.stack, nil)
+		_, before := get(t, discoverer, "/metrics", "")
+		resp, body := get(t, discoverer, "/v1/discover/root-guid"+test.query, "")
+		_, after := get(t, discoverer, "/metrics", "")
+		stop()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%v: expected status 200, got %v: %s", test.name, resp.StatusCode, body)
+			continue
+		}
+		for _, metric := range []string{discoveries(test.outcome), durations(test.outcome)} {
+			if counted := metricValue(t, after, metric) - metricValue(t, before, metric); counted != 1 {
+				t.Errorf("%v: expected %v to count the diagram once, counted %v", test.name, metric, counted)
+			}
+		}
+		sizes := metricValue(t, after, "discoverer_graph_nodes_count") - metricValue(t, before, "discoverer_graph_nodes_count")
+		if sized := sizes == 1; sized != test.sized {
+			t.Errorf("%v: expected graph size observed %v, got %v observations", test.name, test.sized, sizes)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Response formats of discovery
+const (
+	formatJSON   = "json"
+	formatDOT    = "dot"
+	formatSVG    = "svg"
+	formatEvents = "events"
+)
+
+var formatMediaTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatDOT:    "text/vnd.graphviz",
+	formatSVG:    "image/svg+xml",
+	formatEvents: "text/event-stream",
+}
+
+// parseFormat chooses response format by format query parameter or, if not given, by Accept header
+func parseFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if len(format) > 0 {
+		if _, ok := formatMediaTypes[format]; !ok {
+			return "", fmt.Errorf("Unknown format [%v]", format)
+		}
+		return format, nil
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accepted, ";")[0])
+		for format, formatMediaType := range formatMediaTypes {
+			if mediaType == formatMediaType {
+				return format, nil
+			}
+		}
+	}
+	return formatJSON, nil
+}
+
+// parseOptions reads discovery options from request query
+func parseOptions(r *http.Request) (graph.Options, error) {
+	query := r.URL.Query()
+	opts := graph.Options{
+		Cycles: graph.CycleMode(query.Get("cycles")),
+		Errors: graph.ErrorMode(query.Get("errors")),
+	}
+	if waves := query.Get("waves"); len(waves) > 0 {
+		var err error
+		if opts.Waves, err = strconv.ParseBool(waves); err != nil {
+			return opts, fmt.Errorf("Invalid waves value [%v]", waves)
+		}
+	}
+	if envLinks := query.Get("envLinks"); len(envLinks) > 0 {
+		var err error
+		if opts.EnvLinks, err = strconv.ParseBool(envLinks); err != nil {
+			return opts, fmt.Errorf("Invalid envLinks value [%v]", envLinks)
+		}
+	}
+	return opts, checkOptions(&opts)
+}
+
+// checkOptions validates discovery modes, filling in defaults for those not given
+func checkOptions(opts *graph.Options) error {
+	switch opts.Cycles {
+	case "":
+		opts.Cycles = graph.CyclesFail
+	case graph.CyclesFail, graph.CyclesDefer:
+	default:
+		return fmt.Errorf("Unknown cycles mode [%v]. Use %v or %v", opts.Cycles, graph.CyclesFail, graph.CyclesDefer)
+	}
+
+	switch opts.Errors {
+	case "":
+		opts.Errors = graph.ErrorsStrict
+	case graph.ErrorsStrict, graph.ErrorsTolerant:
+	default:
+		return fmt.Errorf("Unknown errors mode [%v]. Use %v or %v", opts.Errors, graph.ErrorsStrict, graph.ErrorsTolerant)
+	}
+	return nil
+}
+
+// isPlanRequested tells whether response has to be a full discovery plan rather than plain list of components
+func isPlanRequested(opts graph.Options) bool {
+	return opts.Cycles == graph.CyclesDefer || opts.Errors == graph.ErrorsTolerant || opts.Waves
+}
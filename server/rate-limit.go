@@ -0,0 +1,97 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// How often buckets of callers which stopped making requests are dropped
+const bucketSweepInterval = time.Minute
+
+// tokenBucket refills at constant rate up to its capacity, and every request takes one token
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// When the bucket refills completely, so it can be dropped and created anew on next request
+	full time.Time
+}
+
+// rateLimiter keeps a token bucket for every caller
+type rateLimiter struct {
+	// Requests per minute allowed to callers without limits of their own, and how many of them may come at once
+	rate    int
+	burst   int
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newRateLimiter(rate, burst int) *rateLimiter {
+	toReturn := new(rateLimiter)
+	toReturn.rate = rate
+	toReturn.burst = burst
+	toReturn.buckets = make(map[string]*tokenBucket)
+	return toReturn
+}
+
+// allow takes a token from the bucket of the caller, identified by Caller.identity.
+// Default limits apply if rate or burst is zero.
+// If the bucket is empty, it returns false and time after which a token will be available.
+func (l *rateLimiter) allow(caller string, rate, burst int, now time.Time) (bool, time.Duration) {
+	if rate == 0 {
+		rate = l.rate
+	}
+	if burst == 0 {
+		burst = l.burst
+	}
+	perSecond := float64(rate) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	bucket, ok := l.buckets[caller]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), updated: now}
+		l.buckets[caller] = bucket
+	}
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	bucket.full = now.Add(time.Duration((float64(burst) - bucket.tokens) / perSecond * float64(time.Second)))
+	return true, 0
+}
+
+// sweep drops buckets which refilled completely, as they do not differ from new ones.
+// Without it every caller ever seen, e.g. every user presenting token, would be kept forever.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < bucketSweepInterval {
+		return
+	}
+	l.swept = now
+	for caller, bucket := range l.buckets {
+		if !bucket.full.After(now) {
+			delete(l.buckets, caller)
+		}
+	}
+}
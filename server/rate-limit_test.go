@@ -0,0 +1,146 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefillsBucket(t *testing.T) {
+	// One request per second, up to three at once
+	limiter := newRateLimiter(60, 3)
+	start := time.Now()
+	steps := []struct {
+		after   time.Duration
+		allowed bool
+		wait    time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, time.Second},
+		{500 * time.Millisecond, false, 500 * time.Millisecond},
+		{time.Second, true, 0},
+		{time.Second, false, time.Second},
+		// Bucket does not fill above burst however long the caller waits
+		{time.Hour, true, 0},
+		{time.Hour, true, 0},
+		{time.Hour, true, 0},
+		{time.Hour, false, time.Second},
+	}
+	for i, step := range steps {
+		allowed, wait := limiter.allow("ci", 0, 0, start.Add(step.after))
+		if allowed != step.allowed || wait != step.wait {
+			t.Errorf("request %v after %v: expected %v with wait %v, got %v with wait %v",
+				i, step.after, step.allowed, step.wait, allowed, wait)
+		}
+	}
+}
+
+func TestRateLimiterLimitsOfClient(t *testing.T) {
+	limiter := newRateLimiter(60, 1)
+	now := time.Now()
+	if allowed, _ := limiter.allow("ci", 0, 0, now); !allowed {
+		t.Error("first request should be allowed")
+	}
+	if allowed, _ := limiter.allow("ci", 0, 0, now); allowed {
+		t.Error("request over default burst should be rejected")
+	}
+	// Other callers have buckets of their own, possibly with their own limits
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.allow("broker", 120, 2, now); !allowed {
+			t.Errorf("request %v within burst of the client should be allowed", i)
+		}
+	}
+	if allowed, wait := limiter.allow("broker", 120, 2, now); allowed || wait != 500*time.Millisecond {
+		t.Errorf("expected rejection with wait given by rate of the client, got %v with wait %v", allowed, wait)
+	}
+}
+
+func TestRateLimiterDropsRefilledBuckets(t *testing.T) {
+	// One request per minute, up to two at once
+	limiter := newRateLimiter(1, 2)
+	start := time.Now()
+	limiter.allow("idle", 0, 0, start)
+	limiter.allow("busy", 0, 0, start)
+	limiter.allow("busy", 0, 0, start)
+
+	// Bucket of idle caller is full again after a minute, the other one after two minutes
+	limiter.allow("new", 0, 0, start.Add(90*time.Second))
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("refilled bucket should be dropped")
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Error("bucket which is not full yet should be kept")
+	}
+	if allowed, _ := limiter.allow("busy", 0, 0, start.Add(90*time.Second)); !allowed {
+		t.Error("request after refill of one token should be allowed")
+	}
+	if allowed, _ := limiter.allow("busy", 0, 0, start.Add(90*time.Second)); allowed {
+		t.Error("kept bucket should be limited")
+	}
+}
+
+func TestRateLimitSeparatesUsersFromClients(t *testing.T) {
+	fake, discoverer, stop := newTestServer(t, cftest.DiamondStack(), map[string]string{
+		"RATE_LIMIT":       "1",
+		"RATE_LIMIT_BURST": "1",
+	})
+	defer stop()
+	// User named like the API client
+	token := userToken(fake, testUser)
+
+	statuses := []int{}
+	var body []byte
+	for _, token := range []string{token, token, ""} {
+		var resp *http.Response
+		resp, body = get(t, discoverer, "/metrics", token)
+		statuses = append(statuses, resp.StatusCode)
+	}
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusTooManyRequests || statuses[2] != http.StatusOK {
+		t.Fatalf("expected 200, 429 and 200, got %v", statuses)
+	}
+	// Users are counted together
+	if !strings.Contains(string(body), `discoverer_rate_limited_requests_total{client="user"}`) {
+		t.Errorf("expected rejected requests of users in metrics, got %s", body)
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	_, discoverer, stop := newTestServer(t, cftest.DiamondStack(), map[string]string{
+		"RATE_LIMIT":       "1",
+		"RATE_LIMIT_BURST": "2",
+	})
+	defer stop()
+
+	statuses := []int{}
+	var resp *http.Response
+	for i := 0; i < 3; i++ {
+		resp, _ = get(t, discoverer, "/v1/discover/root-guid", "")
+		statuses = append(statuses, resp.StatusCode)
+	}
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusOK || statuses[2] != http.StatusTooManyRequests {
+		t.Fatalf("expected 200, 200 and 429, got %v", statuses)
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("expected to retry after 60 seconds, got [%v]", retryAfter)
+	}
+}
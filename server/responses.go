@@ -17,20 +17,168 @@
 package server
 
 import (
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
 	"github.com/trustedanalytics/go-cf-lib/types"
 )
 
-// ComponentsListResponse
+// ComponentsListResponse is the list of components to spawn in reversed topological order.
+// With cycles=defer, errors=tolerant or waves=true, DiscoveryPlan object is returned instead.
 // swagger:response componentsListResponse
 type ComponentsListResponse struct {
+	// Cloud Controller requests made by the discovery
+	XCCCalls int `json:"X-CC-Calls"`
+	// Lookups answered from cache of the discovery
+	XCCCacheHits int `json:"X-CC-Cache-Hits"`
+	// Share of lookups answered from cache
+	XCCCacheHitRatio float64 `json:"X-CC-Cache-Hit-Ratio"`
+	// Array of Component, DiscoveryPlan or, from discovery jobs, DetailedDiscoveryPlan. Swagger 2.0 cannot express
+	// alternatives and go-swagger ignores extensions of response fields, so x-any-of listing them is copied from
+	// Job.result into the document by embed-spec.go.
 	// in: body
-	Body []types.Component
+	Body interface{}
 }
 
-// swagger:parameters discover
+// DiscoveryPlan is a plan of spawning the stack.
+//
+// First create all components in given order, then create deferred bindings.
+// Warnings list components whose dependencies could not be retrieved.
+// If requested, waves group GUIDs of components which can be created concurrently, after all previous waves.
+// swagger:model
+type DiscoveryPlan struct {
+	// required: true
+	Components []types.Component `json:"components"`
+	// required: true
+	DeferredBindings []graph.DeferredBinding `json:"deferredBindings"`
+	Waves            [][]string              `json:"waves,omitempty"`
+	// required: true
+	Warnings []graph.Warning `json:"warnings"`
+}
+
+// DetailedDiscoveryPlan is a plan of spawning the stack with details needed to clone every component.
+//
+// Like DiscoveryPlan, with edges listing all dependencies between components, telling bindings from links
+// found in credentials of user provided services or in environment of applications.
+// Applications and user provided services are given with their space and its organization.
+// swagger:model
+type DetailedDiscoveryPlan struct {
+	// required: true
+	Components []graph.DetailedComponent `json:"components"`
+	// required: true
+	Edges []graph.DependencyEdge `json:"edges"`
+	// required: true
+	DeferredBindings []graph.DeferredBinding `json:"deferredBindings"`
+	Waves            [][]string              `json:"waves,omitempty"`
+	// required: true
+	Warnings []graph.Warning `json:"warnings"`
+}
+
+// DetailedDiscoveryResponse is the plan of spawning the stack, with details needed to clone every component
+// swagger:response detailedDiscoveryResponse
+type DetailedDiscoveryResponse struct {
+	// Cloud Controller requests made by the discovery
+	XCCCalls int `json:"X-CC-Calls"`
+	// Lookups answered from cache of the discovery
+	XCCCacheHits int `json:"X-CC-Cache-Hits"`
+	// Share of lookups answered from cache
+	XCCCacheHitRatio float64 `json:"X-CC-Cache-Hit-Ratio"`
+	// in: body
+	Body DetailedDiscoveryPlan
+}
+
+// swagger:parameters discover discoverV2
 type RootGUIDParam struct {
 	// Root application GUID
 	// in: path
 	// required: true
 	RootGUID string `json:"rootGUID"`
+
+	// What to do when stack has cycles: fail (default) or defer bindings of user provided services
+	// in: query
+	Cycles string `json:"cycles"`
+
+	// What to do when dependencies of a component cannot be retrieved:
+	// strict (default) fails, tolerant returns partial result with warnings
+	// in: query
+	Errors string `json:"errors"`
+
+	// Group components into waves which can be spawned concurrently
+	// in: query
+	Waves bool `json:"waves"`
+
+	// Link applications to those which URLs in their environment point to
+	// in: query
+	EnvLinks bool `json:"envLinks"`
+
+	// Response format: json (default), dot, svg or events
+	// in: query
+	Format string `json:"format"`
+}
+
+// DiscoveryJobRequest starts asynchronous discovery of application stack, with the same options as synchronous one
+type DiscoveryJobRequest struct {
+	// Root application GUID
+	// required: true
+	RootGUID string          `json:"rootGUID"`
+	Cycles   graph.CycleMode `json:"cycles"`
+	Errors   graph.ErrorMode `json:"errors"`
+	Waves    bool            `json:"waves"`
+	// Return components with details needed to clone them
+	Details bool `json:"details"`
+	// Link applications to those which URLs in their environment point to
+	EnvLinks bool `json:"envLinks"`
+	// URL which final status of the job is posted to
+	CallbackURL string `json:"callbackURL"`
+}
+
+// swagger:parameters createDiscovery
+type DiscoveryJobRequestParam struct {
+	// in: body
+	// required: true
+	Body DiscoveryJobRequest
+}
+
+// swagger:parameters getDiscovery
+type DiscoveryJobIDParam struct {
+	// Discovery job ID
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// DiscoveryJobResponse is a status of asynchronous discovery
+// swagger:response discoveryJobResponse
+type DiscoveryJobResponse struct {
+	// in: body
+	Body Job
+}
+
+// HealthResponse tells that the discoverer is running
+// swagger:response healthResponse
+type HealthResponse struct {
+	// in: body
+	Body struct {
+		// required: true
+		Status string `json:"status"`
+	}
+}
+
+// ReadinessResponse tells whether UAA and Cloud Controller are reachable, with detail of every check
+// swagger:response readinessResponse
+type ReadinessResponse struct {
+	// in: body
+	Body Readiness
+}
+
+// MetricsResponse holds metrics in Prometheus text format
+// swagger:response metricsResponse
+type MetricsResponse struct {
+	// in: body
+	Body string
+}
+
+// SpecResponse is this document
+// swagger:response specResponse
+type SpecResponse struct {
+	// in: body
+	Body map[string]interface{}
 }
@@ -20,27 +20,52 @@ import (
 	"fmt"
 	log "github.com/cihub/seelog"
 	"github.com/go-martini/martini"
-	"github.com/martini-contrib/auth"
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"github.com/trustedanalytics/app-dependency-discoverer/metrics"
+	"github.com/trustedanalytics/app-dependency-discoverer/openapi"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	apiVersion = "v1"
+	apiVersion      = "v1"
+	apiVersionAsync = "v2"
 )
 
 var (
-	discoverURLPattern = fmt.Sprintf("/%v/discover/:rootGUID", apiVersion)
+	discoverURLPattern     = fmt.Sprintf("/%v/discover/:rootGUID", apiVersion)
+	discoverV2URLPattern   = fmt.Sprintf("/%v/discover/:rootGUID", apiVersionAsync)
+	discoveriesURLPattern  = fmt.Sprintf("/%v/discoveries", apiVersionAsync)
+	discoveryJobURLPattern = fmt.Sprintf("/%v/discoveries/:id", apiVersionAsync)
+	metricsURLPattern      = "/metrics"
+	healthURLPattern       = "/healthz"
+	readinessURLPattern    = "/readyz"
+	specURLPattern         = fmt.Sprintf("/%v/swagger.json", apiVersion)
 )
 
 type router struct {
 	m *martini.ClassicMartini
 }
 
-// ServeHTTP logs all requests and dispatches to the appropriate handler
+// ServeHTTP logs and measures all requests and dispatches to the appropriate handler
 func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w}
+	defer func() {
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		endpoint := httpEndpoint(req.URL.Path)
+		httpRequests.Inc(endpoint, strconv.Itoa(recorder.status))
+		httpDuration.Observe(time.Since(start).Seconds(), endpoint)
+	}()
+	w = recorder
+
 	if dump, err := httputil.DumpRequest(req, true); err != nil {
 		log.Tracef("Cannot log incoming request: %v", err)
 	} else {
@@ -50,14 +75,66 @@ func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.m.ServeHTTP(w, req)
 }
 
-func Start(config Config) {
+// swagger:route GET /metrics metrics
+//
+// Metrics of the discoverer in Prometheus text format.
+//
+//	Produces:
+//	- text/plain
+//	- application/json
+//
+//	Security:
+//	  basic:
+//	  bearer:
+//
+//	Responses:
+//	  200: metricsResponse
+//	  401: serverError
+//	  403: serverError
+//	  429: serverError
+
+// swagger:route GET /v1/swagger.json spec
+//
+// This document, generated from annotations of the code. Does not require authentication.
+//
+//	Responses:
+//	  200: specResponse
+
+// NewRouter returns handler serving all endpoints of the discoverer
+func NewRouter(config Config) http.Handler {
 	m := martini.Classic()
-	m.Use(auth.Basic(GetEnvVarAsString("AUTH_USER", ""), GetEnvVarAsString("AUTH_PASS", "")))
+	authenticate := newAuthenticator(newTokenVerifier(config), newClientRegistry(config),
+		newRateLimiter(config.RateLimit, config.RateLimitBurst))
 
-	handlers := Handlers{}
-	m.Get(discoverURLPattern, handlers.Discover)
+	handlers := NewHandlers(config, graph.CfClient{CfAPI: config.NewCfAPI()})
+	m.Get(discoverURLPattern, authenticate, handlers.Discover)
+	m.Get(discoverV2URLPattern, authenticate, handlers.DiscoverV2)
+	m.Post(discoveriesURLPattern, authenticate, handlers.CreateDiscovery)
+	m.Get(discoveryJobURLPattern, authenticate, handlers.GetDiscovery)
+	m.Get(metricsURLPattern, authenticate, metrics.DefaultRegistry.ServeHTTP)
+	// Health checks are used by the platform, so they do not require authentication
+	m.Get(healthURLPattern, handlers.Health)
+	m.Get(readinessURLPattern, handlers.Ready)
+	// Neither does the API description, so that clients can be generated from it
+	spec := openapi.MustParse(openapi.Spec)
+	m.Get(specURLPattern, spec.ServeHTTP)
 
-	r := &router{m}
+	if config.ContractValidation {
+		log.Info("Responses are checked against OpenAPI document")
+		return spec.Validating(&router{m}, reportViolation)
+	}
+	return &router{m}
+}
+
+// reportViolation logs response not matching OpenAPI document
+func reportViolation(violation openapi.Violation) {
+	log.Errorf("Response %v to %v %v does not match OpenAPI document:\n  %v", violation.Status,
+		violation.Method, violation.Path, strings.Join(violation.Problems, "\n  "))
+	contractViolations.Inc(httpEndpoint(violation.Path))
+}
+
+func Start(config Config) {
+	r := NewRouter(config)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
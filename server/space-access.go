@@ -0,0 +1,85 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	log "github.com/cihub/seelog"
+	"github.com/trustedanalytics/app-dependency-discoverer/graph"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// spaceAccess tells which spaces the caller may read, asking Cloud Controller with the token of the caller.
+// Answers are remembered for the single discovery it is created for.
+type spaceAccess struct {
+	cfAPI  string
+	token  string
+	client *http.Client
+	mu     sync.Mutex
+	spaces map[string]bool
+}
+
+func newSpaceAccess(cfAPI, token string, client *http.Client) *spaceAccess {
+	toReturn := new(spaceAccess)
+	toReturn.cfAPI = cfAPI
+	toReturn.token = token
+	toReturn.client = client
+	toReturn.spaces = make(map[string]bool)
+	return toReturn
+}
+
+// canRead tells whether Cloud Controller shows the space to the caller
+func (a *spaceAccess) canRead(spaceGUID string) (bool, error) {
+	a.mu.Lock()
+	allowed, ok := a.spaces[spaceGUID]
+	a.mu.Unlock()
+	if ok {
+		return allowed, nil
+	}
+
+	req, err := http.NewRequest("GET", a.cfAPI+"/v2/spaces/"+spaceGUID, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("Cannot check access to space %v: %v", spaceGUID, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		allowed = true
+	case http.StatusUnauthorized:
+		return false, &graph.TokenRejectedError{SpaceGUID: spaceGUID, Status: resp.Status}
+	case http.StatusForbidden, http.StatusNotFound:
+		log.Infof("Caller cannot read space %v: %v", spaceGUID, resp.Status)
+		allowed = false
+	default:
+		return false, fmt.Errorf("Cannot check access to space %v: Cloud Controller responded with %v",
+			spaceGUID, resp.Status)
+	}
+	a.mu.Lock()
+	a.spaces[spaceGUID] = allowed
+	a.mu.Unlock()
+	return allowed, nil
+}
@@ -0,0 +1,140 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/trustedanalytics/app-dependency-discoverer/cftest"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// crossSpaceStack returns stack whose root app in space A is linked to an app in space B,
+// through a route which is listed in space A as it is mapped to an app there too
+func crossSpaceStack() cftest.Stack {
+	route := cftest.Route{GUID: "other-route", Host: "other"}
+	return cftest.Stack{
+		Apps: []cftest.App{
+			{GUID: "other-guid", Name: "other", SpaceGUID: "space-b", Routes: []cftest.Route{route}},
+			{GUID: "root-guid", Name: "root", SpaceGUID: "space-a", Bindings: []string{"other-ups-guid"}},
+			{GUID: "mapped-guid", Name: "mapped", SpaceGUID: "space-a", Routes: []cftest.Route{route}},
+		},
+		UserProvidedServices: []cftest.UserProvidedService{
+			{GUID: "other-ups-guid", Name: "other-ups", SpaceGUID: "space-a",
+				Credentials: map[string]interface{}{"url": route.URL()}},
+		},
+	}
+}
+
+func userToken(fake *cftest.Server, user string) string {
+	return fake.Token(validClaims(map[string]interface{}{"user_name": user, "user_id": user + "-id"}))
+}
+
+func TestDiscoverLimitedToReadableSpaces(t *testing.T) {
+	fake, discoverer, stop := newTestServer(t, crossSpaceStack(), nil)
+	defer stop()
+	both, onlyRoot, none := userToken(fake, "both"), userToken(fake, "only-root"), userToken(fake, "none")
+	fake.Grant(both, "space-a", "space-b")
+	fake.Grant(onlyRoot, "space-a")
+	client := fake.Token(validClaims(map[string]interface{}{"user_name": nil, "user_id": nil, "client_id": "ci"}))
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		guids  []string
+	}{
+		{"all spaces", both, http.StatusOK, []string{"other-guid", "other-ups-guid", "root-guid"}},
+		{"linked space trimmed", onlyRoot, http.StatusOK, []string{"other-ups-guid", "root-guid"}},
+		{"root space denied", none, http.StatusForbidden, nil},
+		{"client not limited", client, http.StatusOK, []string{"other-guid", "other-ups-guid", "root-guid"}},
+		{"basic authentication not limited", "", http.StatusOK, []string{"other-guid", "other-ups-guid", "root-guid"}},
+	}
+	for _, test := range tests {
+		resp, body := get(t, discoverer, "/v1/discover/root-guid", test.token)
+		if resp.StatusCode != test.status {
+			t.Errorf("%v: expected status %v, got %v: %s", test.name, test.status, resp.StatusCode, body)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		components := []testComponent{}
+		if err := json.Unmarshal(body, &components); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		guids := []string{}
+		for _, component := range components {
+			guids = append(guids, component.GUID)
+		}
+		if !reflect.DeepEqual(guids, test.guids) {
+			t.Errorf("%v: expected components %v, got %v", test.name, test.guids, guids)
+		}
+	}
+}
+
+func TestDiscoveryJobReadableByCreatorOnly(t *testing.T) {
+	fake, discoverer, stop := newTestServer(t, crossSpaceStack(), nil)
+	defer stop()
+	alice, bob := userToken(fake, "alice"), userToken(fake, "bob")
+	fake.Grant(alice, "space-a")
+	fake.Grant(bob, "space-a", "space-b")
+
+	req, err := http.NewRequest("POST", discoverer.URL+"/v2/discoveries",
+		bytes.NewBufferString(`{"rootGUID": "root-guid"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+alice)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %v", resp.StatusCode)
+	}
+	location := resp.Header.Get("Location")
+
+	if resp, body := get(t, discoverer, location, alice); resp.StatusCode != http.StatusOK {
+		t.Errorf("creator should read the job, got %v: %s", resp.StatusCode, body)
+	}
+	for name, token := range map[string]string{"other user": bob, "basic authentication": ""} {
+		if resp, body := get(t, discoverer, location, token); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%v should not read the job, got %v: %s", name, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestDiscoverWithTokenRejectedByCloudController(t *testing.T) {
+	fake, discoverer, stop := newTestServer(t, crossSpaceStack(), nil)
+	defer stop()
+	expired := userToken(fake, "expired")
+	fake.Grant(expired, "space-a", "space-b")
+	fake.Revoke(expired)
+
+	for _, query := range []string{"", "?errors=tolerant"} {
+		resp, body := get(t, discoverer, "/v1/discover/root-guid"+query, expired)
+		if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "rejected token") {
+			t.Errorf("%v: expected 401 telling the token was rejected, got %v: %s", query, resp.StatusCode, body)
+		}
+	}
+}